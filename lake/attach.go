@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-04-01/network"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+)
+
+// attachment is a resource a group applies to.
+type attachment struct {
+	Kind string `json:"kind" yaml:"kind"` // eni, instance, nic, subnet, port
+	ID   string `json:"id" yaml:"id"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty"` // eni description, or device for openstack ports
+}
+
+func (a attachment) String() string {
+	if a.Name != "" {
+		return fmt.Sprintf("%s=%s (%s)", a.Kind, a.ID, a.Name)
+	}
+	return fmt.Sprintf("%s=%s", a.Kind, a.ID)
+}
+
+// groupAttachments lists resources live group is attached to.
+func groupAttachments(ref groupRef) ([]attachment, error) {
+	ref.setRegion()
+	switch ref.cloud {
+	case "aws":
+		return attachmentsAws(ref.name, ref.scope)
+	case "azure":
+		return attachmentsAzure(ref.name, ref.scope)
+	}
+	return attachmentsOpenstack(ref.name)
+}
+
+// attachmentsAws lists ENIs holding the group, and their instances.
+func attachmentsAws(name, vpcID string) ([]attachment, error) {
+	svc, errClient := clientAws()
+	if errClient != nil {
+		return nil, errClient
+	}
+
+	sg, errFind := findAws(svc, name, vpcID)
+	if errFind != nil {
+		return nil, errFind
+	}
+
+	return attachmentsAwsGroup(svc, aws.StringValue(sg.GroupId))
+}
+
+func attachmentsAwsGroup(svc *ec2.Client, groupID string) ([]attachment, error) {
+	input := ec2.DescribeNetworkInterfacesInput{
+		Filters: []ec2.Filter{
+			{Name: aws.String("group-id"), Values: []string{groupID}},
+		},
+	}
+
+	out, errSend := svc.DescribeNetworkInterfacesRequest(&input).Send(runCtx)
+	if errSend != nil {
+		return nil, errSend
+	}
+
+	var list []attachment
+	for _, eni := range out.NetworkInterfaces {
+		list = append(list, attachment{Kind: "eni", ID: aws.StringValue(eni.NetworkInterfaceId), Name: aws.StringValue(eni.Description)})
+		if eni.Attachment != nil && eni.Attachment.InstanceId != nil {
+			list = append(list, attachment{Kind: "instance", ID: aws.StringValue(eni.Attachment.InstanceId)})
+		}
+	}
+
+	return list, nil
+}
+
+// attachmentsAzure lists NICs and subnets from NSG properties.
+func attachmentsAzure(name, resourceGroup string) ([]attachment, error) {
+	nsgClient, errClient := clientAzure()
+	if errClient != nil {
+		return nil, errClient
+	}
+
+	sg, errGet := nsgClient.Get(runCtx, resourceGroup, name, "")
+	if errGet != nil {
+		return nil, errGet
+	}
+
+	return attachmentsNsg(sg), nil
+}
+
+func attachmentsNsg(sg network.SecurityGroup) []attachment {
+	var list []attachment
+	if props := sg.SecurityGroupPropertiesFormat; props != nil {
+		if props.NetworkInterfaces != nil {
+			for _, nic := range *props.NetworkInterfaces {
+				list = append(list, attachment{Kind: "nic", ID: unptr(nic.ID)})
+			}
+		}
+		if props.Subnets != nil {
+			for _, subnet := range *props.Subnets {
+				list = append(list, attachment{Kind: "subnet", ID: unptr(subnet.ID)})
+			}
+		}
+	}
+	return list
+}
+
+// attachmentsOpenstack lists ports holding the group.
+func attachmentsOpenstack(name string) ([]attachment, error) {
+	client, errClient := clientOpenstack()
+	if errClient != nil {
+		return nil, errClient
+	}
+
+	groupID, errID := groups.IDFromName(client, name)
+	if errID != nil {
+		return nil, errID
+	}
+
+	allPorts, errPorts := listPortsOpenstack(client)
+	if errPorts != nil {
+		return nil, errPorts
+	}
+
+	return attachmentsPorts(allPorts, groupID), nil
+}
+
+func attachmentsPorts(allPorts []ports.Port, groupID string) []attachment {
+	var list []attachment
+	for _, p := range allPorts {
+		for _, id := range p.SecurityGroups {
+			if id == groupID {
+				device := p.DeviceOwner
+				if p.DeviceID != "" {
+					device += " " + p.DeviceID
+				}
+				list = append(list, attachment{Kind: "port", ID: p.ID, Name: device})
+				break
+			}
+		}
+	}
+	return list
+}
+
+// listPortsOpenstack fetches all ports, for listing attachments of many groups.
+func listPortsOpenstack(client *gophercloud.ServiceClient) ([]ports.Port, error) {
+	allPages, errList := ports.List(client, ports.ListOpts{}).AllPages()
+	if errList != nil {
+		return nil, errList
+	}
+	return ports.ExtractPorts(allPages)
+}
+
+func cmdUsage(me string, args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	ref, errRef := refFromArgs(positional)
+	if errRef != nil {
+		return fmt.Errorf("usage: %v", errRef)
+	}
+
+	list, errAttach := groupAttachments(ref)
+	if errAttach != nil {
+		return errAttach
+	}
+
+	fmt.Printf("group: %s attachments=%d\n", ref, len(list))
+	for _, a := range list {
+		fmt.Printf("attached: %s\n", a)
+	}
+
+	return nil
+}
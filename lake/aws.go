@@ -3,11 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 )
 
@@ -15,36 +15,57 @@ func cloudAws(me, cmd, cloud string, args []string) error {
 
 	switch cmd {
 	case "list":
+		listOpts, listArgs, errFlags := parseListFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
 		var vpcID string
-		if len(args) > 0 {
-			vpcID = args[0]
+		if len(listArgs) > 0 {
+			vpcID = listArgs[0]
 		}
-		return listAws(me, cmd, vpcID)
+		return listAws(me, cmd, vpcID, listOpts)
 	case "pull":
+		pullOpts, pullArgs, errFlags := parsePullFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		args = pullArgs
 		if len(args) < 2 {
-			log.Printf("usage: %s %s %s name vpc-id", me, cmd, cloud)
-			return fmt.Errorf("%s %s %s: missing name vpc-id", me, cmd, cloud)
+			return fmt.Errorf("missing name vpc-id, usage: %s %s %s name vpc-id", me, cmd, cloud)
 		}
 		name := args[0]
 		vpcID := args[1]
-		return pullAws(me, cmd, name, vpcID)
+		return pullAws(me, cmd, name, vpcID, pullOpts)
 	case "push":
+		pushOpts, pushArgs, errFlags := parsePushFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		args = pushArgs
 		if len(args) < 2 {
-			log.Printf("usage: %s %s %s name vpc-id", me, cmd, cloud)
-			return fmt.Errorf("%s %s %s: missing name vpc-id", me, cmd, cloud)
+			return fmt.Errorf("missing name vpc-id, usage: %s %s %s name vpc-id", me, cmd, cloud)
 		}
 		name := args[0]
 		vpcID := args[1]
-		return pushAws(me, cmd, name, vpcID)
+		return pushAws(me, cmd, name, vpcID, pushOpts)
 	}
 
 	return fmt.Errorf("unsupported %s command: %s", cloud, cmd)
 }
 
-func listAws(me, cmd, vpcID string) error {
-	cfg, errConf := external.LoadDefaultAWSConfig()
+func listAws(me, cmd, vpcID string, listOpts listOptions) error {
+	records, errList := listRecordsAws(vpcID, listOpts.usage)
+	if errList != nil {
+		return errList
+	}
+	return writeRecords(listOpts.format, records)
+}
+
+// listRecordsAws lists groups, within vpc when given.
+func listRecordsAws(vpcID string, usage bool) ([]groupRecord, error) {
+	cfg, errConf := loadConfigAws()
 	if errConf != nil {
-		return errConf
+		return nil, errConf
 	}
 
 	svc := ec2.New(cfg)
@@ -61,26 +82,61 @@ func listAws(me, cmd, vpcID string) error {
 
 	req := svc.DescribeSecurityGroupsRequest(&input)
 
-	out, errSend := req.Send(context.TODO())
+	out, errSend := req.Send(runCtx)
 	if errSend != nil {
-		return errSend
+		return nil, errSend
 	}
 
 	count := len(out.SecurityGroups)
-	log.Printf("security groups: %d", count)
+	slog.Debug("security groups found", "cloud", "aws", "scope", vpcID, "count", count)
+
+	var records []groupRecord
 
 	for _, sg := range out.SecurityGroups {
-		fmt.Printf("vpc-id=%s group-name=%s group-id=%s description=%s\n",
-			aws.StringValue(sg.VpcId), aws.StringValue(sg.GroupName), aws.StringValue(sg.GroupId), aws.StringValue(sg.Description))
+		rec := groupRecord{
+			Cloud:       "aws",
+			Scope:       aws.StringValue(sg.VpcId),
+			Name:        aws.StringValue(sg.GroupName),
+			ID:          aws.StringValue(sg.GroupId),
+			Description: aws.StringValue(sg.Description),
+			RulesIn:     countRulesAws(sg.IpPermissions),
+			RulesOut:    countRulesAws(sg.IpPermissionsEgress),
+			Tags:        awsTagsPull(sg.Tags),
+			Extra:       map[string]string{"ownerId": aws.StringValue(sg.OwnerId)},
+		}
+		if usage {
+			rec.setAttachments(attachmentsAwsGroup(svc, rec.ID))
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// countRulesAws counts provider rules: every CIDR and group reference.
+func countRulesAws(permissions []ec2.IpPermission) int {
+	count := countBlocks(permissions)
+	for _, perm := range permissions {
+		count += len(perm.UserIdGroupPairs)
+	}
+	return count
+}
+
+func pullAws(me, cmd, name, vpcID string, pullOpts pullOptions) error {
+	gr, errFetch := fetchAws(name, vpcID)
+	if errFetch != nil {
+		return errFetch
 	}
 
+	pullOpts.output(gr)
+
 	return nil
 }
 
-func pullAws(me, cmd, name, vpcID string) error {
-	cfg, errConf := external.LoadDefaultAWSConfig()
+func fetchAws(name, vpcID string) (*group, error) {
+	cfg, errConf := loadConfigAws()
 	if errConf != nil {
-		return errConf
+		return nil, errConf
 	}
 
 	svc := ec2.New(cfg)
@@ -101,55 +157,52 @@ func pullAws(me, cmd, name, vpcID string) error {
 
 	req := svc.DescribeSecurityGroupsRequest(&input)
 
-	out, errSend := req.Send(context.TODO())
+	out, errSend := req.Send(runCtx)
 	if errSend != nil {
-		return errSend
+		return nil, errSend
 	}
 
 	count := len(out.SecurityGroups)
-	log.Printf("security groups: %d", count)
+	slog.Debug("security groups found", "cloud", "aws", "group", name, "scope", vpcID, "count", count)
 
 	if count < 1 {
-		return fmt.Errorf("no security group found")
+		return nil, fmt.Errorf("no security group found: %w", errGroupNotFound)
 	}
 
 	if count > 1 {
-		return fmt.Errorf("more than one security group found")
+		return nil, fmt.Errorf("more than one security group found")
 	}
 
 	sg := out.SecurityGroups[0]
 
-	gr := group{
+	gr := &group{
 		Description: aws.StringValue(sg.Description),
 	}
 
-	if debug {
-		log.Printf("DEBUG pullAws: permissions IN: %v", sg.IpPermissions)
-		log.Printf("DEBUG pullAws: permissions OUT: %v", sg.IpPermissionsEgress)
-	}
+	slog.Debug("permissions", "cloud", "aws", "group", name, "in", sg.IpPermissions, "out", sg.IpPermissionsEgress)
 
 	gr.RulesIn = scanPerm(name, sg.IpPermissions)
 	gr.RulesOut = scanPerm(name, sg.IpPermissionsEgress)
 
-	gr.output()
+	gr.setTags(awsTagsPull(sg.Tags))
 
-	return nil
+	return gr, nil
 }
 
 func awsProtoPull(p string) string {
 	if p == "-1" {
-		log.Printf("awsProtoPull: replacing protocol='-1' with empty string")
-		return ""
+		slog.Debug("replacing protocol -1 with empty string", "cloud", "aws")
 	}
-	return p
+	return protoNormalize(p)
 }
 
 func awsProtoPush(p string) string {
-	if p == "" {
-		log.Printf("awsProtoPush: replacing empty protocol with '-1'")
-		return "-1"
+	proto, err := protoPush("aws", p)
+	if err != nil {
+		slog.Warn("protocol not mapped", "cloud", "aws", "error", err)
+		return p
 	}
-	return p
+	return proto
 }
 
 func scanPerm(name string, permissions []ec2.IpPermission) []rule {
@@ -157,38 +210,48 @@ func scanPerm(name string, permissions []ec2.IpPermission) []rule {
 	var rules []rule
 
 	for _, perm := range permissions {
-		for _, other := range perm.UserIdGroupPairs {
-			log.Printf("unsupported: this group=%s references another group=%s", name, aws.StringValue(other.GroupId))
-		}
-
 		proto := awsProtoPull(aws.StringValue(perm.IpProtocol))
 
 		r := rule{
-			Protocol:  proto,
-			PortFirst: aws.Int64Value(perm.FromPort),
-			PortLast:  aws.Int64Value(perm.ToPort),
+			Protocol: proto,
+		}
+
+		for _, other := range perm.UserIdGroupPairs {
+			slog.Info("group references another group", "cloud", "aws", "group", name, "ref", aws.StringValue(other.GroupId))
+			if r.Aws == nil {
+				r.Aws = &ruleAws{}
+			}
+			r.Aws.GroupRefs = append(r.Aws.GroupRefs, aws.StringValue(other.GroupId))
+		}
+		if protoIcmp(proto) {
+			// FromPort/ToPort carry ICMP type/code
+			r.IcmpType, r.IcmpCode = icmpPull(aws.Int64Value(perm.FromPort), aws.Int64Value(perm.ToPort))
+		} else {
+			r.PortFirst = aws.Int64Value(perm.FromPort)
+			r.PortLast = aws.Int64Value(perm.ToPort)
 		}
 		for _, b := range perm.IpRanges {
 			blk := block{
-				Address:        aws.StringValue(b.CidrIp),
-				AwsDescription: aws.StringValue(b.Description),
+				Address:     aws.StringValue(b.CidrIp),
+				Description: aws.StringValue(b.Description),
 			}
 			r.Blocks = append(r.Blocks, blk)
 		}
 		for _, b := range perm.Ipv6Ranges {
 			blk := block{
-				Address:        aws.StringValue(b.CidrIpv6),
-				AwsDescription: aws.StringValue(b.Description),
+				Address:     aws.StringValue(b.CidrIpv6),
+				Description: aws.StringValue(b.Description),
 			}
 			r.BlocksV6 = append(r.BlocksV6, blk)
 		}
+		joinDescriptions(&r)
 		rules = append(rules, r)
 	}
 
 	return rules
 }
 
-func pushAws(me, cmd, name, vpcID string) error {
+func pushAws(me, cmd, name, vpcID string, pushOpts pushOptions) error {
 
 	var gr group
 
@@ -196,13 +259,40 @@ func pushAws(me, cmd, name, vpcID string) error {
 		return errLoad
 	}
 
-	cfg, errConf := external.LoadDefaultAWSConfig()
+	return applyAws(me, &gr, name, vpcID, pushOpts)
+}
+
+// applyAws pushes loaded group.
+func applyAws(me string, gr *group, name, vpcID string, pushOpts pushOptions) error {
+
+	if errCheck := checkPush(me, "aws", name, gr, pushOpts); errCheck != nil {
+		return errCheck
+	}
+
+	cfg, errConf := loadConfigAws()
 	if errConf != nil {
 		return errConf
 	}
 
 	svc := ec2.New(cfg)
 
+	parts := pushParts(me, "aws", name, gr, pushOpts)
+	for i, part := range parts {
+		if errStop := stopBetweenParts(name, i, len(parts)); errStop != nil {
+			return errStop
+		}
+		if errPush := pushGroupAws(me, svc, part.gr, part.name, vpcID); errPush != nil {
+			return errPush
+		}
+	}
+
+	warnSplitOriginal("aws", name, parts, func() (*group, error) { return fetchAws(name, vpcID) })
+
+	return nil
+}
+
+func pushGroupAws(me string, svc *ec2.Client, gr *group, name, vpcID string) error {
+
 	filterName := ec2.Filter{
 		Name:   aws.String("group-name"),
 		Values: []string{name},
@@ -219,7 +309,7 @@ func pushAws(me, cmd, name, vpcID string) error {
 
 	req := svc.DescribeSecurityGroupsRequest(&input)
 
-	out, errSend := req.Send(context.TODO())
+	out, errSend := req.Send(runCtx)
 	if errSend != nil {
 		return errSend
 	}
@@ -231,17 +321,17 @@ func pushAws(me, cmd, name, vpcID string) error {
 	}
 
 	if count < 1 {
-		log.Printf("%s: group=%s vpc-id=%s not found", me, name, vpcID)
-		return createAws(svc, &gr, name, vpcID)
+		slog.Info("group not found", "cloud", "aws", "group", name, "scope", vpcID)
+		return createAws(svc, gr, name, vpcID)
 	}
 
 	sg := out.SecurityGroups[0]
 
-	return updateAws(svc, &gr, name, vpcID, aws.StringValue(sg.GroupId))
+	return updateAws(svc, gr, name, vpcID, aws.StringValue(sg.GroupId))
 }
 
 func updateAws(svc *ec2.Client, gr *group, name, vpcID, groupID string) error {
-	log.Printf("updating existing group=%s group-id=%s", name, groupID)
+	slog.Info("updating existing group", "cloud", "aws", "group", name, "scope", vpcID, "group_id", groupID)
 
 	filterName := ec2.Filter{
 		Name:   aws.String("group-name"),
@@ -259,7 +349,7 @@ func updateAws(svc *ec2.Client, gr *group, name, vpcID, groupID string) error {
 
 	req := svc.DescribeSecurityGroupsRequest(&input)
 
-	out, errSend := req.Send(context.TODO())
+	out, errSend := req.Send(runCtx)
 	if errSend != nil {
 		return errSend
 	}
@@ -280,38 +370,170 @@ func updateAws(svc *ec2.Client, gr *group, name, vpcID, groupID string) error {
 		return fmt.Errorf("wrong groupID")
 	}
 
+	if errStop := safePoint(); errStop != nil {
+		return fmt.Errorf("group=%s left unchanged: %v", name, errStop)
+	}
+
+	// replacing rules must not stop halfway, or group is left empty
+	ctx, cancel := criticalContext()
+	defer cancel()
+
+	if errReplace := replaceRulesAws(ctx, svc, gr, sg, name, groupID); errReplace != nil {
+		slog.Error("replacing rules failed, restoring previous rules", "cloud", "aws", "group", name, "group_id", groupID, "error", errReplace)
+		ctxRestore, cancelRestore := criticalContext()
+		defer cancelRestore()
+		if errRestore := restoreAws(ctxRestore, svc, sg, name); errRestore != nil {
+			return fmt.Errorf("group=%s left in unknown state, restore failed: %v (push again to recover): %v", name, errRestore, errReplace)
+		}
+		return fmt.Errorf("group=%s left with previous rules: %v", name, errReplace)
+	}
+
+	if gr.hasTags() {
+		if errTags := updateTagsAws(ctx, svc, gr, name, groupID, sg.Tags); errTags != nil {
+			return fmt.Errorf("updateTagsAws: %v", errTags)
+		}
+	}
+
+	if errStop := safePoint(); errStop != nil {
+		slog.Warn("finished updating group before stopping", "cloud", "aws", "group", name, "error", errStop)
+	}
+
+	return nil
+}
+
+// replaceRulesAws deletes existing rules of sg and creates rules from gr.
+func replaceRulesAws(ctx context.Context, svc *ec2.Client, gr *group, sg ec2.SecurityGroup, name, groupID string) error {
 	countInDel := countBlocks(sg.IpPermissions)
-	log.Printf("group=%s deleting existing %d ingress rules...", name, countInDel)
-	if errDelIn := delPermInAws(svc, sg); errDelIn != nil {
+	slog.Info("deleting existing ingress rules", "cloud", "aws", "group", name, "count", countInDel)
+	if errDelIn := delPermInAws(ctx, svc, sg); errDelIn != nil {
 		return errDelIn
 	}
-	log.Printf("group=%s deleting existing %d ingress rules...done", name, countInDel)
 
 	countOutDel := countBlocks(sg.IpPermissionsEgress)
-	log.Printf("group=%s deleting existing %d egress rules...", name, countOutDel)
-	if errDelIn := delPermOutAws(svc, sg); errDelIn != nil {
+	slog.Info("deleting existing egress rules", "cloud", "aws", "group", name, "count", countOutDel)
+	if errDelIn := delPermOutAws(ctx, svc, sg); errDelIn != nil {
 		return errDelIn
 	}
-	log.Printf("group=%s deleting existing %d egress rules...done", name, countOutDel)
-
-	log.Printf("group=%s creating new rules...", name)
 
-	countIn, errIn := addPermInAws(svc, gr.RulesIn, name, groupID)
+	countIn, errIn := addPermInAws(ctx, svc, gr.RulesIn, name, groupID)
 	if errIn != nil {
 		return fmt.Errorf("addPermInAws: %v", errIn)
 	}
 
-	countOut, errOut := addPermOutAws(svc, gr.RulesOut, name, groupID)
+	countOut, errOut := addPermOutAws(ctx, svc, gr.RulesOut, name, groupID)
 	if errOut != nil {
 		return fmt.Errorf("addPermOutAws: %v", errOut)
 	}
 
-	log.Printf("group=%s creating new rules...done (%d rules)", name, countIn+countOut)
+	slog.Info("created rules", "cloud", "aws", "group", name, "count", countIn+countOut)
+
+	return nil
+}
+
+// restoreAws puts back permissions of previous group state prev.
+func restoreAws(ctx context.Context, svc *ec2.Client, prev ec2.SecurityGroup, name string) error {
+	input := ec2.DescribeSecurityGroupsInput{GroupIds: []string{aws.StringValue(prev.GroupId)}}
+	out, errSend := svc.DescribeSecurityGroupsRequest(&input).Send(ctx)
+	if errSend != nil {
+		return errSend
+	}
+	if len(out.SecurityGroups) != 1 {
+		return fmt.Errorf("group=%s: found %d security groups", name, len(out.SecurityGroups))
+	}
+	cur := out.SecurityGroups[0]
+
+	if errDel := delPermInAws(ctx, svc, cur); errDel != nil {
+		return errDel
+	}
+	if errDel := delPermOutAws(ctx, svc, cur); errDel != nil {
+		return errDel
+	}
+
+	if len(prev.IpPermissions) > 0 {
+		input := ec2.AuthorizeSecurityGroupIngressInput{
+			IpPermissions: prev.IpPermissions,
+			GroupId:       prev.GroupId,
+		}
+		if _, err := svc.AuthorizeSecurityGroupIngressRequest(&input).Send(ctx); err != nil {
+			return err
+		}
+	}
+
+	if len(prev.IpPermissionsEgress) > 0 {
+		input := ec2.AuthorizeSecurityGroupEgressInput{
+			IpPermissions: prev.IpPermissionsEgress,
+			GroupId:       prev.GroupId,
+		}
+		if _, err := svc.AuthorizeSecurityGroupEgressRequest(&input).Send(ctx); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("restored previous rules", "cloud", "aws", "group", name, "count", countBlocks(prev.IpPermissions)+countBlocks(prev.IpPermissionsEgress))
 
 	return nil
 }
 
-func delPermInAws(svc *ec2.Client, sg ec2.SecurityGroup) error {
+func awsTagsPull(tags []ec2.Tag) map[string]string {
+	if len(tags) < 1 {
+		return nil
+	}
+	m := map[string]string{}
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return m
+}
+
+// updateTagsAws makes group tags equal to gr tags.
+func updateTagsAws(ctx context.Context, svc *ec2.Client, gr *group, name, groupID string, existing []ec2.Tag) error {
+	tags, warnings := gr.tagsForCloud("aws")
+	for _, w := range warnings {
+		slog.Warn(w, "cloud", "aws", "group", name)
+	}
+
+	var remove []ec2.Tag
+	for _, t := range existing {
+		key := aws.StringValue(t.Key)
+		if _, found := tags[key]; found || strings.HasPrefix(key, "aws:") {
+			continue
+		}
+		remove = append(remove, ec2.Tag{Key: t.Key})
+	}
+
+	if len(remove) > 0 {
+		slog.Info("deleting tags", "cloud", "aws", "group", name, "count", len(remove))
+		input := ec2.DeleteTagsInput{
+			Resources: []string{groupID},
+			Tags:      remove,
+		}
+		req := svc.DeleteTagsRequest(&input)
+		if _, err := req.Send(ctx); err != nil {
+			return err
+		}
+	}
+
+	if len(tags) < 1 {
+		return nil
+	}
+
+	var create []ec2.Tag
+	for k, v := range tags {
+		create = append(create, ec2.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	slog.Info("setting tags", "cloud", "aws", "group", name, "count", len(create))
+
+	input := ec2.CreateTagsInput{
+		Resources: []string{groupID},
+		Tags:      create,
+	}
+	req := svc.CreateTagsRequest(&input)
+	_, err := req.Send(ctx)
+	return err
+}
+
+func delPermInAws(ctx context.Context, svc *ec2.Client, sg ec2.SecurityGroup) error {
 
 	if len(sg.IpPermissions) < 1 {
 		return nil
@@ -322,11 +544,11 @@ func delPermInAws(svc *ec2.Client, sg ec2.SecurityGroup) error {
 		GroupId:       sg.GroupId,
 	}
 	req := svc.RevokeSecurityGroupIngressRequest(&input)
-	_, err := req.Send(context.TODO())
+	_, err := req.Send(ctx)
 	return err
 }
 
-func delPermOutAws(svc *ec2.Client, sg ec2.SecurityGroup) error {
+func delPermOutAws(ctx context.Context, svc *ec2.Client, sg ec2.SecurityGroup) error {
 
 	if len(sg.IpPermissionsEgress) < 1 {
 		return nil
@@ -337,7 +559,7 @@ func delPermOutAws(svc *ec2.Client, sg ec2.SecurityGroup) error {
 		GroupId:       sg.GroupId,
 	}
 	req := svc.RevokeSecurityGroupEgressRequest(&input)
-	_, err := req.Send(context.TODO())
+	_, err := req.Send(ctx)
 	return err
 }
 
@@ -356,7 +578,7 @@ func awsCidrPush(c string) string {
 	}
 	addr := net.ParseIP(c)
 	if addr == nil {
-		log.Printf("awsCidrPush: bad CIDR: [%s]", c)
+		slog.Warn("bad CIDR", "cloud", "aws", "address", c)
 		return c
 	}
 	if addr.To4() == nil {
@@ -373,61 +595,77 @@ func permFromRules(ruleList []rule) ([]ec2.IpPermission, int) {
 
 	// collapse multiple blocks within single shared proto/port rule
 	for _, r := range ruleList {
-		key := fmt.Sprintf("%s/%d/%d", r.Protocol, r.PortFirst, r.PortLast)
-		if rr, found := table[key]; found {
-			//log.Printf("permFromRules: collapse B: %s blocks: %d [%v]", key, len(r.Blocks)+len(r.BlocksV6), r.Blocks)
+		// resolve block descriptions before rule-level description is lost by collapsing
+		r.Blocks = describeBlocksAws(r.Blocks, r)
+		r.BlocksV6 = describeBlocksAws(r.BlocksV6, r)
 
+		key := fmt.Sprintf("%s/%d/%d/%s/%s", protoNormalize(r.Protocol), r.PortFirst, r.PortLast, icmpString(r.IcmpType), icmpString(r.IcmpCode))
+		if rr, found := table[key]; found {
 			rr.Blocks = append(rr.Blocks, r.Blocks...)
 			rr.BlocksV6 = append(rr.BlocksV6, r.BlocksV6...)
 
-			table[key] = rr // write back
+			if r.Aws != nil {
+				refs := append([]string{}, r.Aws.GroupRefs...)
+				if rr.Aws != nil {
+					refs = append(append([]string{}, rr.Aws.GroupRefs...), refs...)
+				}
+				rr.Aws = &ruleAws{GroupRefs: refs}
+			}
 
-			//log.Printf("permFromRules: collapse A: %s blocks: %d [%v]", key, len(rr.Blocks)+len(rr.BlocksV6), rr.Blocks)
+			table[key] = rr // write back
 
 			continue
 		}
-		//log.Printf("permFromRules: create: %s blocks: %d [%v]", key, len(r.Blocks)+len(r.BlocksV6), r.Blocks)
 		table[key] = r // create
 	}
 
 	for _, r := range table {
 		//key := fmt.Sprintf("%s/%d/%d", r.Protocol, r.PortFirst, r.PortLast)
 		proto := awsProtoPush(r.Protocol)
+		fromPort, toPort := r.PortFirst, r.PortLast
+		if protoIcmp(r.Protocol) {
+			fromPort, toPort = icmpPush(r)
+		}
 		perm := ec2.IpPermission{
 			IpProtocol: aws.String(proto),
-			FromPort:   aws.Int64(r.PortFirst),
-			ToPort:     aws.Int64(r.PortLast),
+			FromPort:   aws.Int64(fromPort),
+			ToPort:     aws.Int64(toPort),
 		}
 		for _, b := range r.Blocks {
 			perm.IpRanges = append(perm.IpRanges, ec2.IpRange{
 				CidrIp:      aws.String(awsCidrPush(b.Address)),
-				Description: aws.String(b.AwsDescription),
+				Description: aws.String(awsDescriptionPush(b.awsDescription(r))),
 			})
 			count++
 		}
 		for _, b := range r.BlocksV6 {
 			perm.Ipv6Ranges = append(perm.Ipv6Ranges, ec2.Ipv6Range{
 				CidrIpv6:    aws.String(awsCidrPush(b.Address)),
-				Description: aws.String(b.AwsDescription),
+				Description: aws.String(awsDescriptionPush(b.awsDescription(r))),
 			})
 			count++
 		}
+		if r.Aws != nil {
+			for _, ref := range r.Aws.GroupRefs {
+				perm.UserIdGroupPairs = append(perm.UserIdGroupPairs, ec2.UserIdGroupPair{
+					GroupId: aws.String(ref),
+				})
+				count++
+			}
+		}
 		permissions = append(permissions, perm)
 	}
 
-	if debug {
-		log.Printf("DEBUG permFromRule: rule: %v", ruleList)
-		log.Printf("DEBUG permFromRule: perm: %v", permissions)
-	}
+	slog.Debug("permissions from rules", "cloud", "aws", "rules", ruleList, "permissions", permissions)
 
 	return permissions, count
 }
 
-func addPermInAws(svc *ec2.Client, ruleList []rule, name, groupID string) (int, error) {
+func addPermInAws(ctx context.Context, svc *ec2.Client, ruleList []rule, name, groupID string) (int, error) {
 
 	permissions, count := permFromRules(ruleList)
 
-	log.Printf("addPermInAws: count=%d", count)
+	slog.Debug("adding ingress permissions", "cloud", "aws", "group", name, "count", count)
 
 	if count < 1 {
 		return count, nil
@@ -438,20 +676,20 @@ func addPermInAws(svc *ec2.Client, ruleList []rule, name, groupID string) (int,
 		GroupId:       aws.String(groupID),
 	}
 	req := svc.AuthorizeSecurityGroupIngressRequest(&input)
-	_, err := req.Send(context.TODO())
+	_, err := req.Send(ctx)
 
 	if err != nil {
-		log.Printf("addPermInAws: %v: %v", err, permissions)
+		slog.Debug("ingress permissions refused", "cloud", "aws", "group", name, "error", err, "permissions", permissions)
 	}
 
 	return count, err
 }
 
-func addPermOutAws(svc *ec2.Client, ruleList []rule, name, groupID string) (int, error) {
+func addPermOutAws(ctx context.Context, svc *ec2.Client, ruleList []rule, name, groupID string) (int, error) {
 
 	permissions, count := permFromRules(ruleList)
 
-	log.Printf("addPermOutAws: count=%d", count)
+	slog.Debug("adding egress permissions", "cloud", "aws", "group", name, "count", count)
 
 	if count < 1 {
 		return count, nil
@@ -462,20 +700,20 @@ func addPermOutAws(svc *ec2.Client, ruleList []rule, name, groupID string) (int,
 		GroupId:       aws.String(groupID),
 	}
 	req := svc.AuthorizeSecurityGroupEgressRequest(&input)
-	_, err := req.Send(context.TODO())
+	_, err := req.Send(ctx)
 
 	return count, err
 }
 
 func createAws(svc *ec2.Client, gr *group, name, vpcID string) error {
-	log.Printf("createAws: creating new group=%s vpc-id=%s", name, vpcID)
+	slog.Info("creating new group", "cloud", "aws", "group", name, "scope", vpcID)
 
 	var desc string
 	if gr.Description != "" {
 		desc = gr.Description
 	} else {
 		desc = name
-		log.Printf("createAws: using group name as description: %s", desc)
+		slog.Info("using group name as description", "cloud", "aws", "group", name)
 	}
 
 	input := ec2.CreateSecurityGroupInput{
@@ -485,14 +723,49 @@ func createAws(svc *ec2.Client, gr *group, name, vpcID string) error {
 	}
 
 	req := svc.CreateSecurityGroupRequest(&input)
-	resp, errCreate := req.Send(context.TODO())
+	resp, errCreate := req.Send(runCtx)
 	if errCreate != nil {
 		return fmt.Errorf("createAws: %v", errCreate)
 	}
 
 	groupID := aws.StringValue(resp.GroupId)
 
-	log.Printf("created new group=%s vpc-id=%s: group-id=%s", name, vpcID, groupID)
+	slog.Info("created new group", "cloud", "aws", "group", name, "scope", vpcID, "group_id", groupID)
+
+	if errStop := safePoint(); errStop != nil {
+		return fmt.Errorf("group=%s created with default rules only: %v", name, errStop)
+	}
 
 	return updateAws(svc, gr, name, vpcID, groupID)
 }
+
+func clientAws() (*ec2.Client, error) {
+	cfg, errConf := loadConfigAws()
+	if errConf != nil {
+		return nil, errConf
+	}
+	return ec2.New(cfg), nil
+}
+
+// findAws finds single group by name within vpc.
+func findAws(svc *ec2.Client, name, vpcID string) (ec2.SecurityGroup, error) {
+	input := ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2.Filter{
+			{Name: aws.String("group-name"), Values: []string{name}},
+			{Name: aws.String("vpc-id"), Values: []string{vpcID}},
+		},
+	}
+
+	out, errSend := svc.DescribeSecurityGroupsRequest(&input).Send(runCtx)
+	if errSend != nil {
+		return ec2.SecurityGroup{}, errSend
+	}
+
+	switch len(out.SecurityGroups) {
+	case 0:
+		return ec2.SecurityGroup{}, fmt.Errorf("group=%s vpc-id=%s: no security group found", name, vpcID)
+	case 1:
+		return out.SecurityGroups[0], nil
+	}
+	return ec2.SecurityGroup{}, fmt.Errorf("group=%s vpc-id=%s: more than one security group found", name, vpcID)
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
-	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -19,61 +19,79 @@ func cloudAzure(me, cmd, cloud string, args []string) error {
 
 	switch cmd {
 	case "list":
-		return listAzure(me, cmd)
+		listOpts, _, errFlags := parseListFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		return listAzure(me, cmd, listOpts)
 	case "pull":
+		pullOpts, pullArgs, errFlags := parsePullFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		args = pullArgs
 		if len(args) < 2 {
-			log.Printf("usage: %s %s %s name resource-group", me, cmd, cloud)
-			return fmt.Errorf("%s %s %s: missing name resource-group", me, cmd, cloud)
+			return fmt.Errorf("missing name resource-group, usage: %s %s %s name resource-group", me, cmd, cloud)
 		}
 		name := args[0]
 		resourceGroup := args[1]
-		return pullAzure(me, cmd, name, resourceGroup)
+		return pullAzure(me, cmd, name, resourceGroup, pullOpts)
 	case "push":
+		pushOpts, pushArgs, errFlags := parsePushFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		args = pushArgs
 		if len(args) < 3 {
-			log.Printf("usage: %s %s %s name resource-group location", me, cmd, cloud)
-			return fmt.Errorf("%s %s %s: missing name resource-group location", me, cmd, cloud)
+			return fmt.Errorf("missing name resource-group location, usage: %s %s %s name resource-group location", me, cmd, cloud)
 		}
 		name := args[0]
 		resourceGroup := args[1]
 		location := args[2]
-		return pushAzure(me, cmd, name, resourceGroup, location)
+		return pushAzure(me, cmd, name, resourceGroup, location, pushOpts)
 	}
 
 	return fmt.Errorf("unsupported %s command: %s", cloud, cmd)
 }
 
 func showCredentialsAzure() {
-	cred("AZURE_SUBSCRIPTION_ID")
-	cred("AZURE_TENANT_ID")
-	cred("AZURE_CLIENT_ID")
+	credHide("AZURE_SUBSCRIPTION_ID")
+	credHide("AZURE_TENANT_ID")
+	credHide("AZURE_CLIENT_ID")
 	credHide("AZURE_CLIENT_SECRET")
 }
 
+// cred logs non-secret configuration env var.
 func cred(env string) {
-	value := os.Getenv(env)
-	log.Printf("credentials %s=[%s]", env, value)
+	slog.Debug("configuration", "env", env, "value", os.Getenv(env))
 }
 
+// credHide logs only whether credential env var is set, never its value.
 func credHide(env string) {
-	value := os.Getenv(env)
-	if value != "" {
-		value = "<hidden>"
+	slog.Debug("configuration", "env", env, "set", os.Getenv(env) != "")
+}
+
+func listAzure(me, cmd string, listOpts listOptions) error {
+	records, errList := listRecordsAzure(listOpts.usage)
+	if errList != nil {
+		return errList
 	}
-	log.Printf("credentials %s=[%s]", env, value)
+	return writeRecords(listOpts.format, records)
 }
 
-func listAzure(me, cmd string) error {
+// listRecordsAzure lists groups in subscription.
+func listRecordsAzure(usage bool) ([]groupRecord, error) {
 
 	showCredentialsAzure()
 
 	subscription := os.Getenv("AZURE_SUBSCRIPTION_ID")
 	if subscription == "" {
-		return fmt.Errorf("missing env var AZURE_SUBSCRIPTION_ID")
+		return nil, fmt.Errorf("missing env var AZURE_SUBSCRIPTION_ID")
 	}
 
 	authorizer, errAuth := auth.NewAuthorizerFromEnvironment()
 	if errAuth != nil {
-		return errAuth
+		return nil, errAuth
 	}
 
 	/*
@@ -92,24 +110,81 @@ func listAzure(me, cmd string) error {
 			rgName := unptr(rg.Name)
 			rgId := unptr(rg.ID)
 			tableRg[rgId] = rgName
-			log.Printf("resource group: name=[%s] id=[%s]", rgName, rgId)
+			slog.Debug("resource group", "name", rgName, "id", rgId)
 		}
 	*/
 
 	nsgClient := network.NewSecurityGroupsClient(subscription)
 	nsgClient.Authorizer = authorizer
+	retryAzure(&nsgClient.Client)
 
-	it, errList := nsgClient.ListAllComplete(context.Background())
+	it, errList := nsgClient.ListAllComplete(runCtx)
 	if errList != nil {
-		return errList
+		return nil, errList
 	}
 
+	var records []groupRecord
+
 	for ; it.NotDone(); it.Next() {
 		nsg := it.Value()
-		fmt.Printf("name=%s location=%s\n", unptr(nsg.Name), unptr(nsg.Location))
+		rec := groupRecord{
+			Cloud: "azure",
+			Scope: azureResourceGroup(unptr(nsg.ID)),
+			Name:  unptr(nsg.Name),
+			ID:    unptr(nsg.ID),
+			Tags:  azureTagsPull(nsg.Tags),
+			Extra: map[string]string{"location": unptr(nsg.Location)},
+		}
+		if props := nsg.SecurityGroupPropertiesFormat; props != nil && props.SecurityRules != nil {
+			for _, sr := range *props.SecurityRules {
+				if sr.SecurityRulePropertiesFormat != nil && sr.Direction == network.SecurityRuleDirectionOutbound {
+					rec.RulesOut++
+				} else {
+					rec.RulesIn++
+				}
+			}
+		}
+		if usage {
+			rec.setAttachments(attachmentsNsg(nsg), nil)
+		}
+		records = append(records, rec)
 	}
 
-	return nil
+	return records, nil
+}
+
+// azureResourceGroup extracts resource group name from resource ID.
+func azureResourceGroup(id string) string {
+	parts := strings.Split(id, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "resourceGroups") {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+func azureTagsPull(tags map[string]*string) map[string]string {
+	if len(tags) < 1 {
+		return nil
+	}
+	m := map[string]string{}
+	for k, v := range tags {
+		if v == nil {
+			m[k] = ""
+			continue
+		}
+		m[k] = *v
+	}
+	return m
+}
+
+func azureTagsPush(tags map[string]string) map[string]*string {
+	m := map[string]*string{}
+	for k, v := range tags {
+		m[k] = to.StringPtr(v)
+	}
+	return m
 }
 
 func unptr(p *string) string {
@@ -126,74 +201,81 @@ func unptrInt32(p *int32) int32 {
 	return *p
 }
 
-func pullAzure(me, cmd, name, resourceGroup string) error {
+func pullAzure(me, cmd, name, resourceGroup string, pullOpts pullOptions) error {
+	gr, errFetch := fetchAzure(name, resourceGroup)
+	if errFetch != nil {
+		return errFetch
+	}
+
+	pullOpts.output(gr)
+
+	return nil
+}
+
+func fetchAzure(name, resourceGroup string) (*group, error) {
 
 	showCredentialsAzure()
 
 	subscription := os.Getenv("AZURE_SUBSCRIPTION_ID")
 	if subscription == "" {
-		return fmt.Errorf("missing env var AZURE_SUBSCRIPTION_ID")
+		return nil, fmt.Errorf("missing env var AZURE_SUBSCRIPTION_ID")
 	}
 
 	authorizer, errAuth := auth.NewAuthorizerFromEnvironment()
 	if errAuth != nil {
-		return errAuth
+		return nil, errAuth
 	}
 
 	nsgClient := network.NewSecurityGroupsClient(subscription)
 	nsgClient.Authorizer = authorizer
+	retryAzure(&nsgClient.Client)
 
-	sg, errGet := nsgClient.Get(context.Background(), resourceGroup, name, "")
+	sg, errGet := nsgClient.Get(runCtx, resourceGroup, name, "")
 	if errGet != nil {
-		return errGet
+		if sg.Response.Response != nil && sg.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %v", errGroupNotFound, errGet)
+		}
+		return nil, errGet
 	}
 
-	var gr group
+	gr := &group{}
 
 	for _, sr := range *sg.SecurityGroupPropertiesFormat.SecurityRules {
-
-		prop := sr.SecurityRulePropertiesFormat
-
-		if nil != prop.DestinationPortRange {
-			visitDstPortRange(&gr, sr, unptr(prop.DestinationPortRange))
-		}
-		for _, dstPortRange := range *prop.DestinationPortRanges {
-			visitDstPortRange(&gr, sr, dstPortRange)
-		}
+		visitSecurityRule(gr, sr)
 	}
 
-	gr.output()
+	gr.setTags(azureTagsPull(sg.Tags))
 
-	return nil
+	return gr, nil
 }
 
 func portValue(port string) int64 {
 	p, err := strconv.Atoi(port)
 	if err != nil {
-		log.Printf("bad port value: '%s' error: %v", port, err)
+		slog.Warn("bad port value", "cloud", "azure", "port", port, "error", err)
 	}
 	return int64(p)
 }
 
 func azureProtoPull(p string) string {
 	if p == "*" {
-		log.Printf("azureProtoPull: replacing protocol='*' with empty string")
-		return ""
+		slog.Debug("replacing protocol * with empty string", "cloud", "azure")
 	}
-	return p
+	return protoNormalize(p)
 }
 
 func azureProtoPush(p string) string {
-	if p == "" {
-		log.Printf("azureProtoPush: replacing empty protocol with '*'")
-		return "*"
+	proto, err := protoPush("azure", p)
+	if err != nil {
+		slog.Warn("protocol not mapped", "cloud", "azure", "error", err)
+		return p
 	}
-	return p
+	return proto
 }
 
 func azurePortPull(p string) (int64, int64) {
 	if p == "*" {
-		log.Printf("azurePortPull: replacing port='*' with 0-65535")
+		slog.Debug("replacing port * with 0-65535", "cloud", "azure")
 		return 0, 65535
 	}
 	ports := strings.Split(p, "-")
@@ -217,9 +299,24 @@ func azurePortPush(first, last int64) string {
 	return fmt.Sprintf("%d-%d", first, last)
 }
 
+// visitSecurityRule adds one lake rule per destination port range of sr.
+func visitSecurityRule(gr *group, sr network.SecurityRule) {
+	prop := sr.SecurityRulePropertiesFormat
+
+	if nil != prop.DestinationPortRange {
+		visitDstPortRange(gr, sr, unptr(prop.DestinationPortRange))
+	}
+	for _, dstPortRange := range *prop.DestinationPortRanges {
+		visitDstPortRange(gr, sr, dstPortRange)
+	}
+}
+
 func visitDstPortRange(gr *group, sr network.SecurityRule, dstPortRange string) {
 	var r rule
-	r.AzureName = unptr(sr.Name)
+	ext := &ruleAzure{}
+	r.Azure = ext
+
+	ext.Name = unptr(sr.Name)
 
 	prop := sr.SecurityRulePropertiesFormat
 
@@ -230,29 +327,31 @@ func visitDstPortRange(gr *group, sr network.SecurityRule, dstPortRange string)
 		desc = unptr(prop.Description)
 	}
 
-	r.AzureDescription = desc
-	r.AzurePriority = unptrInt32(prop.Priority)
-	r.AzureDeny = prop.Access == network.SecurityRuleAccessDeny
+	r.Description = desc
+	ext.Priority = unptrInt32(prop.Priority)
+	ext.Deny = prop.Access == network.SecurityRuleAccessDeny
 
-	r.AzureSourcePortRange = unptr(prop.SourcePortRange)
+	ext.SourcePortRange = unptr(prop.SourcePortRange)
 
 	for _, src := range *prop.SourcePortRanges {
-		r.AzureSourcePortRanges = append(r.AzureSourcePortRanges, src)
+		ext.SourcePortRanges = append(ext.SourcePortRanges, src)
 	}
 
-	r.AzureDestinationAddressPrefix = unptr(prop.DestinationAddressPrefix)
+	ext.DestinationAddressPrefix = unptr(prop.DestinationAddressPrefix)
 
 	for _, src := range *prop.DestinationAddressPrefixes {
-		r.AzureDestinationAddressPrefixes = append(r.AzureDestinationAddressPrefixes, src)
+		ext.DestinationAddressPrefixes = append(ext.DestinationAddressPrefixes, src)
 	}
 
-	r.PortFirst, r.PortLast = azurePortPull(dstPortRange)
+	if !protoIcmp(r.Protocol) {
+		r.PortFirst, r.PortLast = azurePortPull(dstPortRange)
+	}
 
 	if nil != prop.SourceAddressPrefix {
-		visitSrcPrefix(&r, unptr(prop.SourceAddressPrefix), "*", true)
+		visitSrcPrefix(&r, unptr(prop.SourceAddressPrefix), "*")
 	}
 	for _, dst := range *prop.SourceAddressPrefixes {
-		visitSrcPrefix(&r, dst, "*", false)
+		visitSrcPrefix(&r, dst, "*")
 	}
 
 	if prop.Direction == network.SecurityRuleDirectionInbound {
@@ -263,24 +362,28 @@ func visitDstPortRange(gr *group, sr network.SecurityRule, dstPortRange string)
 }
 
 // expand magic prefix to both IPv6 and IPv4
-func visitSrcPrefix(r *rule, prefix, magicDefault string, azureSingle bool) {
+func visitSrcPrefix(r *rule, prefix, magicDefault string) {
+
+	if prefix == "" {
+		return // unset single prefix
+	}
 
 	if prefix == magicDefault {
-		log.Printf("visitSrcPrefix: replacing magicDefault='%s' with 0.0.0.0/0 and ::/0", magicDefault)
-		prefixAdd(r, "0.0.0.0/0", "*", "<skip>", azureSingle)
-		prefixAdd(r, "::/0", "*", "<skip>", azureSingle)
+		slog.Debug("replacing magic prefix with 0.0.0.0/0 and ::/0", "prefix", magicDefault)
+		prefixAdd(r, "0.0.0.0/0")
+		prefixAdd(r, "::/0")
 		return
 	}
 
-	prefixAdd(r, prefix, "", "", azureSingle)
+	prefixAdd(r, prefix)
 }
 
-func prefixAdd(r *rule, prefix string, azurePush4, azurePush6 string, azureSingle bool) {
+func prefixAdd(r *rule, prefix string) {
 
 	if isPrefixV6(prefix) {
-		r.BlocksV6 = append(r.BlocksV6, block{Address: prefix, AzurePush: azurePush6, AzureSingle: azureSingle})
+		r.BlocksV6 = append(r.BlocksV6, block{Address: prefix})
 	} else {
-		r.Blocks = append(r.Blocks, block{Address: prefix, AzurePush: azurePush4, AzureSingle: azureSingle})
+		r.Blocks = append(r.Blocks, block{Address: prefix})
 	}
 }
 
@@ -290,7 +393,7 @@ func visitSrcPrefixV(r *rule, prefix, magicDefault string, isV6 bool) {
 	if isV6 {
 		// IPv6
 		if prefix == magicDefault {
-			log.Printf("replacing magicDefault='%s' with ::/0", magicDefault)
+			slog.Debug("replacing magic prefix with ::/0", "prefix", magicDefault)
 			visitSrcPrefixV(r, "::/0", magicDefault, isV6)
 			return
 		}
@@ -303,7 +406,7 @@ func visitSrcPrefixV(r *rule, prefix, magicDefault string, isV6 bool) {
 	// IPv4
 
 	if prefix == magicDefault {
-		log.Printf("replacing magicDefault='%s' with 0.0.0.0/0", magicDefault)
+		slog.Debug("replacing magic prefix with 0.0.0.0/0", "prefix", magicDefault)
 		visitSrcPrefixV(r, "0.0.0.0/0", magicDefault, isV6)
 		return
 	}
@@ -314,13 +417,13 @@ func visitSrcPrefixV(r *rule, prefix, magicDefault string, isV6 bool) {
 func isPrefixV6(prefix string) bool {
 	addr, _, err := net.ParseCIDR(prefix)
 	if err != nil {
-		log.Printf("bad CIDR address: '%s' error: %v", prefix, err)
+		slog.Warn("bad CIDR", "address", prefix, "error", err)
 		return false
 	}
 	return addr.To4() == nil
 }
 
-func pushAzure(me, cmd, name, resourceGroup, location string) error {
+func pushAzure(me, cmd, name, resourceGroup, location string, pushOpts pushOptions) error {
 
 	var gr group
 
@@ -328,6 +431,16 @@ func pushAzure(me, cmd, name, resourceGroup, location string) error {
 		return errLoad
 	}
 
+	return applyAzure(me, &gr, name, resourceGroup, location, pushOpts)
+}
+
+// applyAzure pushes loaded group.
+func applyAzure(me string, gr *group, name, resourceGroup, location string, pushOpts pushOptions) error {
+
+	if errCheck := checkPush(me, "azure", name, gr, pushOpts); errCheck != nil {
+		return errCheck
+	}
+
 	showCredentialsAzure()
 
 	subscription := os.Getenv("AZURE_SUBSCRIPTION_ID")
@@ -342,14 +455,20 @@ func pushAzure(me, cmd, name, resourceGroup, location string) error {
 
 	nsgClient := network.NewSecurityGroupsClient(subscription)
 	nsgClient.Authorizer = authorizer
+	retryAzure(&nsgClient.Client)
 
-	sg, errGet := nsgClient.Get(context.Background(), resourceGroup, name, "")
+	sg, errGet := nsgClient.Get(runCtx, resourceGroup, name, "")
 	if errGet != nil {
-		log.Printf("pushAzure: group=%s not found: %v", name, errGet)
-		return createAzure(nsgClient, name, resourceGroup, &gr, location)
+		slog.Info("group not found", "cloud", "azure", "group", name, "scope", resourceGroup, "error", errGet)
+		return createAzure(nsgClient, name, resourceGroup, gr, location)
+	}
+
+	if !gr.hasTags() {
+		// CreateOrUpdate replaces whole NSG, keep existing tags
+		gr.setTags(azureTagsPull(sg.Tags))
 	}
 
-	return updateAzure(nsgClient, name, resourceGroup, &gr, unptr(sg.ID), location)
+	return updateAzure(nsgClient, name, resourceGroup, gr, unptr(sg.ID), location)
 }
 
 func createAzure(nsgClient network.SecurityGroupsClient, name, resourceGroup string, gr *group, location string) error {
@@ -363,11 +482,23 @@ func updateAzure(nsgClient network.SecurityGroupsClient, name, resourceGroup str
 	nsg.ID = to.StringPtr(groupID)
 	nsg.Name = to.StringPtr(name)
 
-	future, errUpdate := nsgClient.CreateOrUpdate(context.Background(), resourceGroup, name, nsg)
+	if errStop := safePoint(); errStop != nil {
+		return fmt.Errorf("group=%s left unchanged: %v", name, errStop)
+	}
+
+	// the whole NSG is replaced by a single request, wait for it past interrupt
+	ctx, cancel := criticalContext()
+	defer cancel()
+
+	future, errUpdate := nsgClient.CreateOrUpdate(ctx, resourceGroup, name, nsg)
 	if errUpdate != nil {
 		return errUpdate
 	}
 
+	if errWait := future.WaitForCompletionRef(ctx, nsgClient.Client); errWait != nil {
+		return fmt.Errorf("group=%s update submitted, final state unknown (check with pull): %v", name, errWait)
+	}
+
 	_, errResult := future.Result(nsgClient)
 	if errResult != nil {
 		return errResult
@@ -389,75 +520,135 @@ func networkSecurityGroupFromGroup(gr *group, location string) network.SecurityG
 		Location:                      to.StringPtr(location),
 	}
 
-	for _, r := range gr.RulesIn {
-		sr := securityRuleFromRule(r, network.SecurityRuleDirectionInbound)
-		list = append(list, sr)
+	if gr.hasTags() {
+		tags, warnings := gr.tagsForCloud("azure")
+		for _, w := range warnings {
+			slog.Warn(w, "cloud", "azure")
+		}
+		sg.Tags = azureTagsPush(tags)
+	}
+
+	for _, set := range azureRuleSets(gr.RulesIn) {
+		list = append(list, securityRuleFromSet(set, network.SecurityRuleDirectionInbound))
 	}
 
-	for _, r := range gr.RulesOut {
-		sr := securityRuleFromRule(r, network.SecurityRuleDirectionOutbound)
-		list = append(list, sr)
+	for _, set := range azureRuleSets(gr.RulesOut) {
+		list = append(list, securityRuleFromSet(set, network.SecurityRuleDirectionOutbound))
 	}
 
 	return sg
 }
 
+// securityRuleFromSet builds one NSG rule from rules differing only in ports,
+// as pulled from an NSG rule with several destination port ranges.
+func securityRuleFromSet(set []rule, direction network.SecurityRuleDirection) network.SecurityRule {
+	sr := securityRuleFromRule(set[0], direction)
+	if len(set) > 1 {
+		var dstPortRanges []string
+		for _, r := range set {
+			dstPortRanges = append(dstPortRanges, azurePortPush(r.PortFirst, r.PortLast))
+		}
+		sr.DestinationPortRanges = &dstPortRanges
+	}
+	return sr
+}
+
 func securityRuleFromRule(r rule, direction network.SecurityRuleDirection) network.SecurityRule {
 
 	//dstPortRanges := []string{fmt.Sprintf("%d-%d", r.PortFirst, r.PortLast)}
 	dstPortRanges := []string{azurePortPush(r.PortFirst, r.PortLast)}
+	if protoIcmp(r.Protocol) {
+		dstPortRanges = []string{"*"} // azure has no ICMP type/code
+	}
+
+	ext := r.azure()
 
 	srcPrefixes := []string{}
 	var srcPrefixSingle string
 
 	format := &network.SecurityRulePropertiesFormat{
-		Description:                to.StringPtr(r.AzureDescription),
+		Description:                to.StringPtr(limitDescription("securityRuleFromRule", r.ruleDescription(), descMaxAzure)),
 		Protocol:                   network.SecurityRuleProtocol(azureProtoPush(r.Protocol)),
 		Direction:                  direction,
 		DestinationPortRanges:      &dstPortRanges,
-		SourcePortRange:            to.StringPtr(r.AzureSourcePortRange),
-		SourcePortRanges:           &r.AzureSourcePortRanges,
-		DestinationAddressPrefix:   to.StringPtr(r.AzureDestinationAddressPrefix),
-		DestinationAddressPrefixes: &r.AzureDestinationAddressPrefixes,
-		Priority:                   to.Int32Ptr(r.AzurePriority),
+		SourcePortRange:            to.StringPtr(ext.SourcePortRange),
+		SourcePortRanges:           &ext.SourcePortRanges,
+		DestinationAddressPrefix:   to.StringPtr(ext.DestinationAddressPrefix),
+		DestinationAddressPrefixes: &ext.DestinationAddressPrefixes,
+		Priority:                   to.Int32Ptr(ext.Priority),
 		SourceAddressPrefix:        &srcPrefixSingle,
 		SourceAddressPrefixes:      &srcPrefixes,
 	}
 
-	if r.AzureDeny {
+	if ext.Deny {
 		format.Access = network.SecurityRuleAccessDeny
 	} else {
 		format.Access = network.SecurityRuleAccessAllow
 	}
 
 	sr := network.SecurityRule{
-		Name:                         to.StringPtr(r.AzureName),
+		Name:                         to.StringPtr(ext.Name),
 		SecurityRulePropertiesFormat: format,
 	}
 
-	getSrcPrefixesAzure(&srcPrefixSingle, &srcPrefixes, r.Blocks)
-	getSrcPrefixesAzure(&srcPrefixSingle, &srcPrefixes, r.BlocksV6)
+	addresses := srcAddressesAzure(r)
+	if len(addresses) == 1 {
+		srcPrefixSingle = addresses[0]
+	} else {
+		srcPrefixes = addresses
+	}
+
+	slog.Debug("rule source addresses", "cloud", "azure", "rule", ext.Name, "addresses", addresses)
 
 	return sr
 }
 
-func getSrcPrefixesAzure(srcPrefixSingle *string, srcPrefixes *[]string, blocks []block) {
-	for _, b := range blocks {
-		address := b.Address
-		log.Printf("getSrcPrefixesAzure: address=%s azurePush=[%s]", address, b.AzurePush)
-		if b.AzurePush == "<skip>" {
-			//log.Printf("dst address=%s azurePush=[%s] - skipping address", address, b.AzurePush)
-			continue // don't push
-		}
-		if b.AzurePush != "" {
-			//log.Printf("dst address=%s azurePush=[%s] - using azurePush", address, b.AzurePush)
-			address = b.AzurePush
-		}
-		log.Printf("getSrcPrefixesAzure: azureSingle=%v address=%s", b.AzureSingle, address)
-		if b.AzureSingle {
-			*srcPrefixSingle = address
-		} else {
-			*srcPrefixes = append(*srcPrefixes, address)
+// srcAddressesAzure lists addresses pushed to azure for rule blocks.
+// Both 0.0.0.0/0 and ::/0 collapse into azure "*".
+func srcAddressesAzure(r rule) []string {
+	var world4, world6 bool
+	for _, b := range r.Blocks {
+		world4 = world4 || b.Address == "0.0.0.0/0"
+	}
+	for _, b := range r.BlocksV6 {
+		world6 = world6 || b.Address == "::/0"
+	}
+	if world4 && world6 {
+		return []string{"*"}
+	}
+
+	var addresses []string
+	for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+		for _, b := range blocks {
+			address := b.Address
+			if b.Azure != nil && b.Azure.Address != "" {
+				address = b.Azure.Address
+			}
+			if address == "*" {
+				return []string{"*"}
+			}
+			addresses = append(addresses, address)
 		}
 	}
+	return addresses
+}
+
+func clientAzure() (network.SecurityGroupsClient, error) {
+	showCredentialsAzure()
+
+	subscription := os.Getenv("AZURE_SUBSCRIPTION_ID")
+	if subscription == "" {
+		return network.SecurityGroupsClient{}, fmt.Errorf("missing env var AZURE_SUBSCRIPTION_ID")
+	}
+
+	authorizer, errAuth := auth.NewAuthorizerFromEnvironment()
+	if errAuth != nil {
+		return network.SecurityGroupsClient{}, errAuth
+	}
+
+	nsgClient := network.NewSecurityGroupsClient(subscription)
+	nsgClient.Authorizer = authorizer
+	retryAzure(&nsgClient.Client)
+
+	return nsgClient, nil
 }
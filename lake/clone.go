@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+)
+
+// cmdClone copies rules, description and tags of a group into a new group
+// within the same cloud and scope.
+func cmdClone(me string, args []string) error {
+	var pushOpts pushOptions
+
+	fs := flag.NewFlagSet("clone", flag.ContinueOnError)
+	pushOpts.register(fs)
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	// cloud src dst scope... -> refs sharing scope
+	if len(positional) < 3 {
+		return fmt.Errorf("clone: need cloud src dst [scope]")
+	}
+	srcArgs := append([]string{positional[0], positional[1]}, positional[3:]...)
+	src, errRef := refFromArgs(srcArgs)
+	if errRef != nil {
+		return fmt.Errorf("clone: %v", errRef)
+	}
+	dst := src
+	dst.name = positional[2]
+
+	if dst.cloud == "azure" {
+		location, errLoc := azureLocation(src.name, src.scope)
+		if errLoc != nil {
+			return errLoc
+		}
+		dst.location = location
+	}
+
+	if _, errDst := groupFromCloud(me, dst.cloud, dst.pullArgs()); errDst == nil {
+		return fmt.Errorf("clone: target group %s already exists", dst)
+	}
+
+	gr, errSrc := groupFromCloud(me, src.cloud, src.pullArgs())
+	if errSrc != nil {
+		return errSrc
+	}
+
+	slog.Info("cloning group", "cloud", src.cloud, "group", src.name, "scope", src.scope, "target", dst.name)
+
+	return applyGroup(me, dst, gr, pushOpts)
+}
+
+// cmdRename renames group in place, keeping its attachments.
+// Only OpenStack supports changing group name. AWS group names and Azure
+// resource names are immutable: use clone, move attachments, then delete.
+func cmdRename(me string, args []string) error {
+	fs := flag.NewFlagSet("rename", flag.ContinueOnError)
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	if len(positional) < 3 {
+		return fmt.Errorf("rename: need cloud name new-name [scope]")
+	}
+
+	srcArgs := append([]string{positional[0], positional[1]}, positional[3:]...)
+	ref, errRef := refFromArgs(srcArgs)
+	if errRef != nil {
+		return fmt.Errorf("rename: %v", errRef)
+	}
+
+	if ref.cloud != "openstack" {
+		return fmt.Errorf("rename: %s group names are immutable: clone, move attachments, then delete (see README)", ref.cloud)
+	}
+
+	ref.setRegion()
+
+	return renameOpenstack(me, ref.name, positional[2])
+}
+
+func renameOpenstack(me, name, newName string) error {
+	client, errClient := clientOpenstack()
+	if errClient != nil {
+		return errClient
+	}
+
+	groupID, errID := groups.IDFromName(client, name)
+	if errID != nil {
+		return errID
+	}
+
+	if _, errExists := groups.IDFromName(client, newName); errExists == nil {
+		return fmt.Errorf("rename: group=%s already exists", newName)
+	}
+
+	if _, errUpdate := groups.Update(client, groupID, groups.UpdateOpts{Name: newName}).Extract(); errUpdate != nil {
+		return errUpdate
+	}
+
+	slog.Info("renamed group", "cloud", "openstack", "group", name, "new_name", newName, "group_id", groupID)
+
+	return nil
+}
+
+// azureLocation finds location of existing NSG.
+func azureLocation(name, resourceGroup string) (string, error) {
+	nsgClient, errClient := clientAzure()
+	if errClient != nil {
+		return "", errClient
+	}
+
+	sg, errGet := nsgClient.Get(runCtx, resourceGroup, name, "")
+	if errGet != nil {
+		return "", errGet
+	}
+
+	return unptr(sg.Location), nil
+}
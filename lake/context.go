@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultTimeout bounds a command unless --timeout is given. Zero disables.
+const defaultTimeout = 10 * time.Minute
+
+// criticalGrace bounds calls finishing a rule replacement after
+// interrupt or timeout, so a group is not left half updated.
+const criticalGrace = 2 * time.Minute
+
+var errInterrupted = errors.New("interrupted")
+
+// runCtx bounds every cloud call.
+// It is cancelled by --timeout or by first SIGINT/SIGTERM.
+var runCtx = context.Background()
+
+func parseTimeout(s string) (time.Duration, error) {
+	d, errParse := time.ParseDuration(s)
+	if errParse != nil {
+		return 0, fmt.Errorf("bad timeout: %v", errParse)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("bad timeout: %s", s)
+	}
+	return d, nil
+}
+
+// setupContext installs runCtx.
+// First interrupt cancels in-flight calls and stops at next safe point.
+// Second interrupt exits at once.
+func setupContext(timeout time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	cancelTimeout := func() {}
+	if timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timeout %v exceeded (see --timeout)", timeout))
+	}
+
+	runCtx = ctx
+
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		s := <-sig
+		slog.Warn("interrupted, stopping at next safe point (interrupt again to exit now)", "signal", s.String())
+		cancel(errInterrupted)
+		s = <-sig
+		slog.Error("interrupted again, exiting now: groups being updated may be left in partial state", "signal", s.String())
+		os.Exit(130)
+	}()
+
+	stopTimeoutLog := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			slog.Error("stopping at next safe point", "error", context.Cause(ctx))
+		}
+	})
+
+	return func() {
+		stopTimeoutLog()
+		signal.Stop(sig)
+		cancelTimeout()
+		cancel(nil)
+	}
+}
+
+// safePoint returns the reason to stop when runCtx is done, nil otherwise.
+// Callers check it before starting changes which must not stop halfway.
+func safePoint() error {
+	if runCtx.Err() == nil {
+		return nil
+	}
+	return context.Cause(runCtx)
+}
+
+// stopBetweenParts reports split parts left unpushed when stopping before part i.
+func stopBetweenParts(name string, i, parts int) error {
+	if i < 1 {
+		return nil // nothing pushed yet, push stops by itself
+	}
+	if errStop := safePoint(); errStop != nil {
+		return fmt.Errorf("group=%s: pushed %d of %d parts: %v", name, i, parts, errStop)
+	}
+	return nil
+}
+
+// criticalContext bounds calls which must not stop halfway, such as
+// deleting old rules and creating new ones. It outlives runCtx by criticalGrace.
+func criticalContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(runCtx), criticalGrace)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+)
+
+func cmdCopy(me string, args []string) error {
+	var pushOpts pushOptions
+
+	fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+	pushOpts.register(fs)
+	dryRun := fs.Bool("dry-run", false, "show plan without pushing")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	if len(positional) != 2 {
+		return fmt.Errorf("copy: need source (file or cloud:name@scope) and target cloud:name@scope")
+	}
+
+	dst, isRef := parseGroupRef(positional[1])
+	if !isRef {
+		return fmt.Errorf("copy: bad target: %s", positional[1])
+	}
+	if errRef := checkRef(dst); errRef != nil {
+		return fmt.Errorf("copy: %v", errRef)
+	}
+
+	gr, errSrc := groupFromLocation(me, positional[0])
+	if errSrc != nil {
+		return errSrc
+	}
+
+	warnings, errs := prepareCopy(dst.cloud, gr)
+	for _, w := range warnings {
+		slog.Warn(w, "cloud", dst.cloud, "group", dst.name)
+	}
+	for _, e := range errs {
+		slog.Error("incompatible rule", "cloud", dst.cloud, "group", dst.name, "error", e)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("copy: %d rule(s) incompatible with %s", len(errs), dst.cloud)
+	}
+
+	// plan: current target against copied group
+	current, errCurrent := groupFromCloud(me, dst.cloud, dst.pullArgs())
+	if errCurrent != nil {
+		slog.Info("target not fetched, planning against empty group", "cloud", dst.cloud, "group", dst.name, "scope", dst.scope, "error", errCurrent)
+		current = &group{}
+	}
+	d := diffGroups(current, gr)
+	d.From = dst.String()
+	d.To = positional[0]
+	fmt.Printf("plan: copy %s to %s\n", positional[0], dst)
+	if dst.cloud == "azure" {
+		for i, r := range gr.RulesIn {
+			fmt.Printf("plan: in rule=%d %s\n", i, r.describe())
+		}
+		for i, r := range gr.RulesOut {
+			fmt.Printf("plan: out rule=%d %s\n", i, r.describe())
+		}
+	}
+	d.writeText()
+	if d.empty() {
+		fmt.Println("plan: no rule changes")
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	return applyGroup(me, dst, gr, pushOpts)
+}
+
+// prepareCopy adapts group pulled from any cloud for target cloud.
+// Provider group references are dropped, since they are not valid in other
+// clouds. Azure rules get names and priorities.
+func prepareCopy(cloud string, gr *group) ([]string, []string) {
+	var warnings, errs []string
+
+	if cloud != "openstack" && gr.Openstack != nil {
+		if gr.stateless() {
+			warnings = append(warnings, fmt.Sprintf("dropping openstack stateless flag not supported by %s: rules are stateful", cloud))
+		}
+		gr.Openstack = nil
+	}
+
+	gr.eachRule(func(dir string, i int, r *rule) {
+		loc := ruleLoc(dir, i)
+
+		if cloud != "aws" && r.Aws != nil && len(r.Aws.GroupRefs) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: dropping aws group refs: %v", loc, r.Aws.GroupRefs))
+			r.Aws = nil
+		}
+		if cloud != "openstack" && r.Openstack != nil && r.Openstack.RemoteGroupID != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: dropping openstack remote group: %s", loc, r.Openstack.RemoteGroupID))
+			r.Openstack = nil
+		}
+		if cloud != "azure" && r.Azure != nil {
+			warnings = append(warnings, dropAzureFilters(loc, cloud, r.Azure)...)
+		}
+
+		if cloud == "azure" {
+			return
+		}
+
+		// azure only
+		if r.deny() {
+			errs = append(errs, fmt.Sprintf("%s: deny rule not supported by %s", loc, cloud))
+		}
+		for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+			for _, b := range blocks {
+				if _, errNet := blockNet(b.Address); errNet != nil && b.Address != "*" {
+					errs = append(errs, fmt.Sprintf("%s: address %s not supported by %s", loc, b.Address, cloud))
+				}
+			}
+		}
+	})
+
+	if cloud == "azure" {
+		for _, errFill := range []error{fillAzure(gr.RulesIn, "in"), fillAzure(gr.RulesOut, "out")} {
+			if errFill != nil {
+				errs = append(errs, errFill.Error())
+			}
+		}
+	}
+
+	return warnings, errs
+}
+
+// dropAzureFilters clears azure destination prefixes and source ports,
+// which other clouds cannot express. The copied rule allows any of them.
+func dropAzureFilters(loc, cloud string, ext *ruleAzure) []string {
+	var warnings []string
+	if azureFilter(ext.DestinationAddressPrefix) {
+		warnings = append(warnings, fmt.Sprintf("%s: dropping azure destination prefix not supported by %s: %s", loc, cloud, ext.DestinationAddressPrefix))
+	}
+	if len(ext.DestinationAddressPrefixes) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%s: dropping azure destination prefixes not supported by %s: %v", loc, cloud, ext.DestinationAddressPrefixes))
+	}
+	if azureFilter(ext.SourcePortRange) {
+		warnings = append(warnings, fmt.Sprintf("%s: dropping azure source port range not supported by %s: %s", loc, cloud, ext.SourcePortRange))
+	}
+	if len(ext.SourcePortRanges) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%s: dropping azure source port ranges not supported by %s: %v", loc, cloud, ext.SourcePortRanges))
+	}
+	ext.DestinationAddressPrefix = ""
+	ext.DestinationAddressPrefixes = nil
+	ext.SourcePortRange = ""
+	ext.SourcePortRanges = nil
+	return warnings
+}
+
+// azureFilter reports whether azure prefix or port range restricts traffic.
+func azureFilter(s string) bool {
+	return s != "" && s != "*"
+}
+
+// fillAzure assigns missing azure names and priorities, after priorities in use,
+// and any source port and destination prefix to rules without them.
+// Priorities step by 10, or less when rules would not fit below azurePriorityMax.
+func fillAzure(ruleList []rule, direction string) error {
+	var used, missing int32
+	for _, r := range ruleList {
+		if r.Azure != nil && r.Azure.Priority > used {
+			used = r.Azure.Priority
+		}
+		if r.Azure == nil || r.Azure.Priority == 0 {
+			missing++
+		}
+	}
+
+	next, step := int32(azurePriorityMin), int32(10)
+	if used >= azurePriorityMin {
+		next = used + step
+	}
+	if missing > 0 && next+(missing-1)*step > azurePriorityMax {
+		if used >= azurePriorityMin {
+			next = used + 1
+		}
+		if missing > 1 {
+			step = (azurePriorityMax - next) / (missing - 1)
+		}
+	}
+	if missing > 0 && (step < 1 || next+(missing-1)*step > azurePriorityMax) {
+		return fmt.Errorf("%s: %d rule(s) need azure priority, no room left in %d-%d after priority %d",
+			direction, missing, azurePriorityMin, azurePriorityMax, used)
+	}
+
+	for i := range ruleList {
+		r := &ruleList[i]
+		if r.Azure == nil {
+			r.Azure = &ruleAzure{}
+		}
+		if r.Azure.Name == "" {
+			r.Azure.Name = fmt.Sprintf("lake-%s-%d", direction, i)
+		}
+		if r.Azure.Priority == 0 {
+			r.Azure.Priority = next
+			next += step
+		}
+		if r.Azure.SourcePortRange == "" && len(r.Azure.SourcePortRanges) == 0 {
+			r.Azure.SourcePortRange = "*"
+		}
+		if r.Azure.DestinationAddressPrefix == "" && len(r.Azure.DestinationAddressPrefixes) == 0 {
+			r.Azure.DestinationAddressPrefix = "*"
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestFillAzure(t *testing.T) {
+	table := []struct {
+		name     string
+		used     []int32 // priorities already set, 0 for missing
+		missing  int
+		wantErr  bool
+		wantLast int32 // priority of last rule
+	}{
+		{"empty", nil, 3, false, 120},
+		{"after used", []int32{300}, 2, false, 320},
+		{"400 rules", nil, 400, false, 4090},
+		{"compressed", nil, 1000, false, 100 + 999*4},
+		{"compressed after used", []int32{4000}, 96, false, 4096},
+		{"last free priority", []int32{4095}, 1, false, 4096},
+		{"too many", nil, 4000, true, 0},
+		{"no room after used", []int32{4096}, 1, true, 0},
+	}
+
+	for _, data := range table {
+		var ruleList []rule
+		for _, p := range data.used {
+			ruleList = append(ruleList, rule{Azure: &ruleAzure{Name: "used", Priority: p}})
+		}
+		for i := 0; i < data.missing; i++ {
+			ruleList = append(ruleList, rule{})
+		}
+
+		errFill := fillAzure(ruleList, "in")
+		if (errFill != nil) != data.wantErr {
+			t.Errorf("%s: error=%v, want error=%v", data.name, errFill, data.wantErr)
+			continue
+		}
+		if data.wantErr {
+			continue
+		}
+
+		seen := map[int32]bool{}
+		for i, r := range ruleList {
+			ext := r.Azure
+			if errs := validateAzure(ruleLoc("in", i), r); len(errs) > 0 {
+				t.Errorf("%s: %v", data.name, errs)
+			}
+			if seen[ext.Priority] {
+				t.Errorf("%s: rule %d: duplicate priority=%d", data.name, i, ext.Priority)
+			}
+			seen[ext.Priority] = true
+			if ext.SourcePortRange != "*" || ext.DestinationAddressPrefix != "*" {
+				t.Errorf("%s: rule %d: source port range=%q destination prefix=%q, want *", data.name, i, ext.SourcePortRange, ext.DestinationAddressPrefix)
+			}
+		}
+		if last := ruleList[len(ruleList)-1].Azure.Priority; last != data.wantLast {
+			t.Errorf("%s: last priority=%d, want %d", data.name, last, data.wantLast)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+)
+
+// deleteGroup removes live group, refusing groups still attached.
+func deleteGroup(me string, ref groupRef) error {
+	list, errAttach := groupAttachments(ref)
+	if errAttach != nil {
+		return errAttach
+	}
+	if len(list) > 0 {
+		for _, a := range list {
+			slog.Warn("group attached", "cloud", ref.cloud, "group", ref.name, "scope", ref.scope, "attachment", a.String())
+		}
+		return fmt.Errorf("group %s still attached to %d resource(s), refusing to delete", ref, len(list))
+	}
+
+	ref.setRegion()
+	switch ref.cloud {
+	case "aws":
+		return deleteAws(me, ref.name, ref.scope)
+	case "azure":
+		return deleteAzure(me, ref.name, ref.scope)
+	}
+	return deleteOpenstack(me, ref.name)
+}
+
+func cmdDelete(me string, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "confirm deletion")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	ref, errRef := refFromArgs(positional)
+	if errRef != nil {
+		return fmt.Errorf("delete: %v", errRef)
+	}
+
+	if !*yes {
+		list, errAttach := groupAttachments(ref)
+		if errAttach != nil {
+			return errAttach
+		}
+		for _, a := range list {
+			fmt.Printf("attached: %s\n", a)
+		}
+		return fmt.Errorf("delete: would delete %s (%d attachment(s)), confirm with --yes", ref, len(list))
+	}
+
+	return deleteGroup(me, ref)
+}
+
+func deleteAws(me, name, vpcID string) error {
+	svc, errClient := clientAws()
+	if errClient != nil {
+		return errClient
+	}
+
+	sg, errFind := findAws(svc, name, vpcID)
+	if errFind != nil {
+		return errFind
+	}
+
+	groupID := aws.StringValue(sg.GroupId)
+
+	input := ec2.DeleteSecurityGroupInput{GroupId: aws.String(groupID)}
+	if _, errDel := svc.DeleteSecurityGroupRequest(&input).Send(runCtx); errDel != nil {
+		return errDel
+	}
+
+	slog.Info("deleted group", "cloud", "aws", "group", name, "scope", vpcID, "group_id", groupID)
+
+	return nil
+}
+
+func deleteAzure(me, name, resourceGroup string) error {
+	nsgClient, errClient := clientAzure()
+	if errClient != nil {
+		return errClient
+	}
+
+	future, errDel := nsgClient.Delete(runCtx, resourceGroup, name)
+	if errDel != nil {
+		return errDel
+	}
+
+	if errWait := future.WaitForCompletionRef(runCtx, nsgClient.Client); errWait != nil {
+		return fmt.Errorf("group=%s delete submitted, final state unknown (check with list): %v", name, errWait)
+	}
+
+	if _, errResult := future.Result(nsgClient); errResult != nil {
+		return errResult
+	}
+
+	slog.Info("deleted group", "cloud", "azure", "group", name, "scope", resourceGroup)
+
+	return nil
+}
+
+func deleteOpenstack(me, name string) error {
+	client, errClient := clientOpenstack()
+	if errClient != nil {
+		return errClient
+	}
+
+	groupID, errID := groups.IDFromName(client, name)
+	if errID != nil {
+		return errID
+	}
+
+	if errDel := groups.Delete(client, groupID).ExtractErr(); errDel != nil {
+		return errDel
+	}
+
+	slog.Info("deleted group", "cloud", "openstack", "group", name, "group_id", groupID)
+
+	return nil
+}
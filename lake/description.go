@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// Provider limits for rule descriptions.
+const (
+	descMaxAws       = 255 // per CIDR
+	descMaxAzure     = 140 // per security rule
+	descMaxOpenstack = 255 // per security group rule
+)
+
+// ruleDescription is the description of whole rule: portable field,
+// or else distinct block descriptions joined.
+func (r rule) ruleDescription() string {
+	if r.Description != "" {
+		return r.Description
+	}
+	var list []string
+	seen := map[string]bool{}
+	for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+		for _, b := range blocks {
+			d := b.blockDescription(rule{})
+			if d == "" || seen[d] {
+				continue
+			}
+			seen[d] = true
+			list = append(list, d)
+		}
+	}
+	return strings.Join(list, "; ")
+}
+
+// blockDescription is the description of single block: portable field,
+// or else the rule description.
+func (b block) blockDescription(r rule) string {
+	if b.Description != "" {
+		return b.Description
+	}
+	return r.Description
+}
+
+// awsDescription is the block description pushed to aws.
+func (b block) awsDescription(r rule) string {
+	if b.Aws != nil && b.Aws.Description != "" {
+		return b.Aws.Description
+	}
+	return b.blockDescription(r)
+}
+
+// describeBlocksAws copies blocks, filling in their effective aws descriptions.
+func describeBlocksAws(blocks []block, r rule) []block {
+	var list []block
+	for _, b := range blocks {
+		b.Description = b.awsDescription(r)
+		b.Aws = nil
+		list = append(list, b)
+	}
+	return list
+}
+
+// joinDescriptions moves description shared by all blocks up to rule.
+func joinDescriptions(r *rule) {
+	var shared string
+	var count int
+	for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+		for _, b := range blocks {
+			if count == 0 {
+				shared = b.Description
+			}
+			count++
+			if b.Description != shared {
+				return
+			}
+		}
+	}
+	if count == 0 || shared == "" {
+		return
+	}
+	r.Description = shared
+	for i := range r.Blocks {
+		r.Blocks[i].Description = ""
+	}
+	for i := range r.BlocksV6 {
+		r.BlocksV6[i].Description = ""
+	}
+}
+
+// limitDescription truncates description to provider limit.
+func limitDescription(caller, desc string, max int) string {
+	if len(desc) <= max {
+		return desc
+	}
+	slog.Warn("description truncated", "caller", caller, "max", max, "description", desc)
+	return truncateUTF8(desc, max)
+}
+
+// truncateUTF8 cuts s to at most max bytes, without splitting a rune.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+const awsDescriptionChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 ._-:/()#,@[]+=&;{}!$*"
+
+// awsDescriptionClean replaces chars not accepted by AWS.
+func awsDescriptionClean(desc string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(awsDescriptionChars, r) {
+			return r
+		}
+		return '_'
+	}, desc)
+}
+
+// awsDescriptionPush limits description to charset and length accepted by AWS.
+func awsDescriptionPush(desc string) string {
+	clean := awsDescriptionClean(desc)
+	if clean != desc {
+		slog.Warn("description unsupported chars replaced", "cloud", "aws", "description", desc)
+	}
+	return limitDescription("awsDescriptionPush", clean, descMaxAws)
+}
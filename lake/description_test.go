@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLimitDescription(t *testing.T) {
+	table := []struct {
+		desc string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"truncated", 5, "trunc"},
+		{"café", 4, "caf"},
+		{"café", 5, "café"},
+		{"日本語", 4, "日"},
+		{"日本語", 2, ""},
+		{"a€b", 3, "a"},
+		{"a€b", 4, "a€"},
+		{"", 0, ""},
+		{"é", 0, ""},
+		{"ab", 1, "a"},
+		{"\U0001F600x", 3, ""},
+	}
+
+	for _, data := range table {
+		got := limitDescription("test", data.desc, data.max)
+		if got != data.want {
+			t.Errorf("desc=%q max=%d: got %q, want %q", data.desc, data.max, got, data.want)
+		}
+		if !utf8.ValidString(got) || len(got) > data.max {
+			t.Errorf("desc=%q max=%d: bad result %q", data.desc, data.max, got)
+		}
+	}
+}
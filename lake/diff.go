@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+)
+
+var errDiffer = errors.New("groups differ")
+
+// policyEntry is a single normalized provider entry: one remote address
+// allowed or denied for a protocol/port.
+type policyEntry struct {
+	Protocol string `json:"protocol"`
+	Ports    string `json:"ports"`
+	Address  string `json:"address"`
+	Access   string `json:"access"`
+}
+
+func (e policyEntry) String() string {
+	return fmt.Sprintf("%s %s %s %s", e.Access, e.Protocol, e.Ports, e.Address)
+}
+
+type directionDiff struct {
+	Added   []policyEntry `json:"added"`
+	Removed []policyEntry `json:"removed"`
+}
+
+type groupDiff struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	In   directionDiff `json:"in"`
+	Out  directionDiff `json:"out"`
+}
+
+func (d groupDiff) empty() bool {
+	return len(d.In.Added)+len(d.In.Removed)+len(d.Out.Added)+len(d.Out.Removed) == 0
+}
+
+func cmdDiff(me string, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := fs.String("format", "text", "output format: text|json")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	if len(positional) != 2 {
+		return fmt.Errorf("diff: need two groups: file or cloud:name@scope")
+	}
+
+	from, errFrom := groupFromLocation(me, positional[0])
+	if errFrom != nil {
+		return errFrom
+	}
+
+	to, errTo := groupFromLocation(me, positional[1])
+	if errTo != nil {
+		return errTo
+	}
+
+	d := diffGroups(from, to)
+	d.From = positional[0]
+	d.To = positional[1]
+
+	switch *format {
+	case "text":
+		d.writeText()
+	case "json":
+		if errJSON := writeJSON(d); errJSON != nil {
+			return errJSON
+		}
+	default:
+		return fmt.Errorf("diff: bad format: %s", *format)
+	}
+
+	if !d.empty() {
+		return errDiffer
+	}
+
+	return nil
+}
+
+func (d groupDiff) writeText() {
+	fmt.Printf("--- %s\n", d.From)
+	fmt.Printf("+++ %s\n", d.To)
+	for _, dir := range []struct {
+		name string
+		diff directionDiff
+	}{{"in", d.In}, {"out", d.Out}} {
+		if len(dir.diff.Added)+len(dir.diff.Removed) == 0 {
+			continue
+		}
+		fmt.Printf("@@ %s @@\n", dir.name)
+		for _, e := range dir.diff.Removed {
+			fmt.Printf("-%s\n", e)
+		}
+		for _, e := range dir.diff.Added {
+			fmt.Printf("+%s\n", e)
+		}
+	}
+}
+
+// diffGroups compares normalized entries, so groups pushed to different
+// clouds compare equal when they allow the same traffic.
+// Rule order and Azure priorities are not compared.
+func diffGroups(from, to *group) groupDiff {
+	return groupDiff{
+		In:  diffEntries(policyEntries(from.RulesIn), policyEntries(to.RulesIn)),
+		Out: diffEntries(policyEntries(from.RulesOut), policyEntries(to.RulesOut)),
+	}
+}
+
+func diffEntries(from, to map[string]policyEntry) directionDiff {
+	d := directionDiff{Added: []policyEntry{}, Removed: []policyEntry{}}
+	for k, e := range to {
+		if _, found := from[k]; !found {
+			d.Added = append(d.Added, e)
+		}
+	}
+	for k, e := range from {
+		if _, found := to[k]; !found {
+			d.Removed = append(d.Removed, e)
+		}
+	}
+	sortEntries(d.Added)
+	sortEntries(d.Removed)
+	return d
+}
+
+func sortEntries(list []policyEntry) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+}
+
+// policyEntries flattens rules into normalized entries keyed by their text form.
+func policyEntries(ruleList []rule) map[string]policyEntry {
+	table := map[string]policyEntry{}
+
+	for _, r := range ruleList {
+		base := policyEntry{
+			Protocol: protoNormalize(r.Protocol),
+			Ports:    r.portsString(),
+			Access:   "allow",
+		}
+		if protoAny(r.Protocol) {
+			base.Protocol = "all"
+		}
+		if r.deny() {
+			base.Access = "deny"
+		}
+
+		var addresses []string
+		for _, list := range [][]block{r.Blocks, r.BlocksV6} {
+			for _, b := range list {
+				addresses = append(addresses, normalizeAddress(b.Address))
+			}
+		}
+		if r.Aws != nil {
+			for _, ref := range r.Aws.GroupRefs {
+				addresses = append(addresses, "group:"+ref)
+			}
+		}
+		if r.Openstack != nil && r.Openstack.RemoteGroupID != "" {
+			addresses = append(addresses, "group:"+r.Openstack.RemoteGroupID)
+		}
+
+		for _, a := range addresses {
+			e := base
+			e.Address = a
+			table[e.String()] = e
+		}
+	}
+
+	return table
+}
+
+// portsString formats rule ports, or ICMP type/code.
+func (r rule) portsString() string {
+	switch {
+	case protoIcmp(r.Protocol):
+		return fmt.Sprintf("type=%s,code=%s", icmpString(r.IcmpType), icmpString(r.IcmpCode))
+	case protoAny(r.Protocol) || r.portsAny():
+		return "all"
+	}
+	return formatPortRange(r.PortFirst, r.PortLast)
+}
+
+// normalizeAddress spells CIDRs canonically, keeping other addresses as is.
+func normalizeAddress(address string) string {
+	n, errNet := blockNet(address)
+	if errNet != nil {
+		return address
+	}
+	return n.String()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// extensionErrors validates provider extensions for target cloud.
+// Each cloud checks only its own extension, others are ignored.
+func extensionErrors(cloud string, gr *group) []string {
+	switch cloud {
+	case "aws":
+		return forEachRule(gr, validateAws)
+	case "azure":
+		errors := forEachRule(gr, validateAzure)
+		return append(errors, azureUniqueErrors(gr)...)
+	case "openstack":
+		return forEachRule(gr, validateOpenstack)
+	}
+	return nil
+}
+
+func forEachRule(gr *group, validate func(loc string, r rule) []string) []string {
+	var errors []string
+	gr.eachRule(func(dir string, i int, r *rule) {
+		errors = append(errors, validate(ruleLoc(dir, i), *r)...)
+	})
+	return errors
+}
+
+func validateAws(loc string, r rule) []string {
+	if r.Aws == nil {
+		return nil
+	}
+	var errors []string
+	for _, ref := range r.Aws.GroupRefs {
+		if !strings.HasPrefix(ref, "sg-") {
+			errors = append(errors, fmt.Sprintf("%s: aws: bad group ref: %s", loc, ref))
+		}
+	}
+	return errors
+}
+
+// Azure security rule priority range.
+const (
+	azurePriorityMin = 100
+	azurePriorityMax = 4096
+)
+
+func validateAzure(loc string, r rule) []string {
+	if r.Azure == nil {
+		return []string{fmt.Sprintf("%s: azure: missing extension with name and priority", loc)}
+	}
+	var errors []string
+	if r.Azure.Name == "" {
+		errors = append(errors, fmt.Sprintf("%s: azure: missing name", loc))
+	}
+	if r.Azure.Priority < azurePriorityMin || r.Azure.Priority > azurePriorityMax {
+		errors = append(errors, fmt.Sprintf("%s: azure: priority=%d out of range %d-%d", loc, r.Azure.Priority, azurePriorityMin, azurePriorityMax))
+	}
+	for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+		for _, b := range blocks {
+			if b.Azure != nil && b.Azure.Address == "" {
+				errors = append(errors, fmt.Sprintf("%s: azure: block %s: empty address", loc, b.Address))
+			}
+		}
+	}
+	return errors
+}
+
+// azureUniqueErrors checks names unique per NSG and priorities unique per direction.
+// Rules pulled from one NSG rule with several destination port ranges
+// share name and priority, and are pushed back as that single rule.
+func azureUniqueErrors(gr *group) []string {
+	var errors []string
+	names := map[string]bool{}
+	for _, list := range [][]rule{gr.RulesIn, gr.RulesOut} {
+		priorities := map[int32]string{}
+		for _, set := range azureRuleSets(list) {
+			r := set[0]
+			if r.Azure == nil {
+				continue
+			}
+			if names[r.Azure.Name] {
+				errors = append(errors, fmt.Sprintf("azure: duplicate rule name: %s", r.Azure.Name))
+			}
+			names[r.Azure.Name] = true
+			if other, found := priorities[r.Azure.Priority]; found {
+				errors = append(errors, fmt.Sprintf("azure: rules %s and %s share priority=%d", other, r.Azure.Name, r.Azure.Priority))
+			}
+			priorities[r.Azure.Priority] = r.Azure.Name
+		}
+	}
+	return errors
+}
+
+// azureRuleSets groups rules making a single NSG rule: rules with same
+// azure name which differ only in port range. Order of first rule is kept.
+func azureRuleSets(ruleList []rule) [][]rule {
+	var sets [][]rule
+	byName := map[string]int{}
+	for _, r := range ruleList {
+		if r.Azure != nil && r.Azure.Name != "" {
+			if i, found := byName[r.Azure.Name]; found && samePortsAside(sets[i][0], r) {
+				sets[i] = append(sets[i], r)
+				continue
+			}
+			byName[r.Azure.Name] = len(sets)
+		}
+		sets = append(sets, []rule{r})
+	}
+	return sets
+}
+
+// samePortsAside reports whether rules are equal except for port range.
+func samePortsAside(a, b rule) bool {
+	if protoIcmp(a.Protocol) {
+		return false
+	}
+	a.PortFirst, a.PortLast = b.PortFirst, b.PortLast
+	return reflect.DeepEqual(a, b)
+}
+
+func validateOpenstack(loc string, r rule) []string {
+	if r.Openstack == nil {
+		return nil
+	}
+	switch r.Openstack.EtherType {
+	case "", "IPv4", "IPv6":
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: openstack: bad ethertype: %s", loc, r.Openstack.EtherType)}
+}
+
+func checkExtensions(me, cloud, name string, gr *group) error {
+	errors := extensionErrors(cloud, gr)
+	for _, e := range errors {
+		slog.Error("invalid extension", "cloud", cloud, "group", name, "error", e)
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("group=%s: %d invalid %s extension(s)", name, len(errors), cloud)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-04-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// TestAzurePortRangesRoundTrip pulls an NSG rule with several destination
+// port ranges and pushes it back as a single NSG rule.
+func TestAzurePortRangesRoundTrip(t *testing.T) {
+	sr := network.SecurityRule{
+		Name: to.StringPtr("web"),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Protocol:                   network.SecurityRuleProtocolTCP,
+			Direction:                  network.SecurityRuleDirectionInbound,
+			Access:                     network.SecurityRuleAccessAllow,
+			Priority:                   to.Int32Ptr(100),
+			SourcePortRange:            to.StringPtr("*"),
+			SourcePortRanges:           &[]string{},
+			SourceAddressPrefix:        to.StringPtr("10.0.0.0/8"),
+			SourceAddressPrefixes:      &[]string{},
+			DestinationAddressPrefix:   to.StringPtr("*"),
+			DestinationAddressPrefixes: &[]string{},
+			DestinationPortRanges:      &[]string{"80", "443-444"},
+		},
+	}
+
+	gr := &group{}
+	visitSecurityRule(gr, sr)
+
+	if len(gr.RulesIn) != 2 {
+		t.Fatalf("pulled %d rules, want 2", len(gr.RulesIn))
+	}
+
+	if errs := azureUniqueErrors(gr); len(errs) > 0 {
+		t.Errorf("pulled group refused: %v", errs)
+	}
+
+	if n := providerRules("azure", gr.RulesIn); n != 1 {
+		t.Errorf("azure rule count %d, want 1", n)
+	}
+
+	nsg := networkSecurityGroupFromGroup(gr, "westeurope")
+	pushed := *nsg.SecurityRules
+	if len(pushed) != 1 {
+		t.Fatalf("pushed %d rules, want 1", len(pushed))
+	}
+	got := *pushed[0].DestinationPortRanges
+	want := []string{"80-80", "443-444"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("pushed port ranges %v, want %v", got, want)
+	}
+}
+
+func TestAzureUniqueErrors(t *testing.T) {
+	r1 := rule{Protocol: "tcp", PortFirst: 80, PortLast: 80, Azure: &ruleAzure{Name: "web", Priority: 100}}
+	r2 := r1
+	r2.PortFirst, r2.PortLast = 443, 443
+	r3 := r1
+	r3.Blocks = []block{{Address: "10.0.0.0/8"}} // same name, differs beyond ports
+	r4 := rule{Protocol: "tcp", Azure: &ruleAzure{Name: "other", Priority: 100}}
+
+	table := []struct {
+		name  string
+		rules []rule
+		want  int
+	}{
+		{"port ranges of one rule", []rule{r1, r2}, 0},
+		{"duplicate name", []rule{r1, r3}, 2}, // name and priority
+		{"shared priority", []rule{r1, r4}, 1},
+	}
+
+	for _, data := range table {
+		errs := azureUniqueErrors(&group{RulesIn: data.rules})
+		if len(errs) != data.want {
+			t.Errorf("%s: got %d errors, want %d: %v", data.name, len(errs), data.want, errs)
+		}
+	}
+}
@@ -2,62 +2,383 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+// errGroupNotFound is wrapped by fetch errors when the live group does not exist.
+var errGroupNotFound = errors.New("group not found")
+
 type group struct {
-	Description string // !azure
+	APIVersion  string            `yaml:"apiVersion"`
+	Kind        string            `yaml:"kind"`
+	Defs        []string          `yaml:",omitempty"` // template definition files, relative to group file
+	Description string            // !azure
+	Owner       string            `yaml:",omitempty"` // stored as provider tag lake-owner
+	Ticket      string            `yaml:",omitempty"` // stored as provider tag lake-ticket
+	Tags        map[string]string `yaml:",omitempty"`
 	RulesIn     []rule
 	RulesOut    []rule
+
+	// provider extensions
+	Openstack *groupOpenstack `yaml:",omitempty"`
+}
+
+type groupOpenstack struct {
+	Stateful *bool `yaml:",omitempty"` // false for stateless group, nil keeps provider setting
+}
+
+// stateless reports whether group asks for stateless rules. Only OpenStack has them.
+func (g *group) stateless() bool {
+	return g.Openstack != nil && g.Openstack.Stateful != nil && !*g.Openstack.Stateful
 }
 
 type rule struct {
-	AzurePriority                   int32    // azure-only
-	AzureName                       string   // azure-only
-	AzureDeny                       bool     // azure-only
-	AzureDescription                string   // azure-only
-	AzureSourcePortRange            string   // azure-only
-	AzureSourcePortRanges           []string // azure-only
-	AzureDestinationAddressPrefix   string   // azure-only
-	AzureDestinationAddressPrefixes []string // azure-only
-	Protocol                        string
-	PortFirst                       int64
-	PortLast                        int64
-	Blocks                          []block
-	BlocksV6                        []block
+	Include     string   `yaml:",omitempty"` // template snippet name, replaced by snippet rules
+	Description string   `yaml:",omitempty"`
+	Service     string   `yaml:",omitempty"` // service alias, expanded into Protocol/PortFirst/PortLast on load
+	Ports       []string `yaml:",omitempty"` // port list "80", "8000-8100", expanded into PortFirst/PortLast on load
+	Protocol    string
+	PortFirst   int64
+	PortLast    int64
+	IcmpType    *int64 `yaml:",omitempty"` // icmp/icmpv6 only, nil means any type
+	IcmpCode    *int64 `yaml:",omitempty"` // icmp/icmpv6 only, nil means any code
+	Blocks      []block
+	BlocksV6    []block
+
+	// provider extensions
+	Aws       *ruleAws       `yaml:",omitempty"`
+	Azure     *ruleAzure     `yaml:",omitempty"`
+	Openstack *ruleOpenstack `yaml:",omitempty"`
+
+	// lake/v1 flat fields, moved into Azure extension on load
+	AzurePriority                   int32    `yaml:",omitempty"`
+	AzureName                       string   `yaml:",omitempty"`
+	AzureDeny                       bool     `yaml:",omitempty"`
+	AzureDescription                string   `yaml:",omitempty"`
+	AzureSourcePortRange            string   `yaml:",omitempty"`
+	AzureSourcePortRanges           []string `yaml:",omitempty"`
+	AzureDestinationAddressPrefix   string   `yaml:",omitempty"`
+	AzureDestinationAddressPrefixes []string `yaml:",omitempty"`
+}
+
+type ruleAws struct {
+	GroupRefs []string `yaml:",omitempty"` // referenced security group IDs
+}
+
+type ruleAzure struct {
+	Name                       string
+	Priority                   int32
+	Deny                       bool     `yaml:",omitempty"`
+	SourcePortRange            string   `yaml:",omitempty"`
+	SourcePortRanges           []string `yaml:",omitempty"`
+	DestinationAddressPrefix   string   `yaml:",omitempty"`
+	DestinationAddressPrefixes []string `yaml:",omitempty"`
+}
+
+type ruleOpenstack struct {
+	RemoteGroupID string `yaml:",omitempty"` // referenced security group ID
+	EtherType     string `yaml:",omitempty"` // IPv4|IPv6 for remote group rule, default IPv4
 }
 
 type block struct {
-	Address        string
-	AwsDescription string // aws-only
-	AzurePush      string // azure-only
-	AzureSingle    bool   // azure-only
+	Address     string
+	Description string `yaml:",omitempty"`
+
+	// provider extensions
+	Aws   *blockAws   `yaml:",omitempty"`
+	Azure *blockAzure `yaml:",omitempty"`
+
+	// lake/v1 flat fields, moved into extensions on load
+	AwsDescription string `yaml:",omitempty"`
+	AzurePush      string `yaml:",omitempty"`
+	AzureSingle    bool   `yaml:",omitempty"`
+}
+
+type blockAws struct {
+	Description string `yaml:",omitempty"` // overrides portable description on aws
+}
+
+type blockAzure struct {
+	Address string `yaml:",omitempty"` // pushed to azure instead of Address, e.g. service tag
+}
+
+// azure returns rule Azure extension, zero value when absent.
+func (r rule) azure() ruleAzure {
+	if r.Azure == nil {
+		return ruleAzure{}
+	}
+	return *r.Azure
+}
+
+// azureDestinations returns azure destination prefixes, nil meaning any.
+func (r rule) azureDestinations() []string {
+	ext := r.azure()
+	return azureFilterList(ext.DestinationAddressPrefix, ext.DestinationAddressPrefixes)
+}
+
+// azureSourcePorts returns azure source port ranges, nil meaning any.
+func (r rule) azureSourcePorts() []string {
+	ext := r.azure()
+	return azureFilterList(ext.SourcePortRange, ext.SourcePortRanges)
+}
+
+func azureFilterList(single string, plural []string) []string {
+	list := plural
+	if len(list) == 0 && single != "" {
+		list = []string{single}
+	}
+	for _, s := range list {
+		if s == "*" {
+			return nil
+		}
+	}
+	return list
+}
+
+// deny reports whether rule denies traffic. Only Azure has deny rules.
+func (r rule) deny() bool {
+	return r.azure().Deny
 }
 
 func groupFromStdin(caller, name string, gr *group) error {
-	dec := yaml.NewDecoder(bufio.NewReader(os.Stdin))
+	slog.Debug("reading group YAML from stdin", "group", name)
+
+	if errDec := groupFromReader(os.Stdin, gr); errDec != nil {
+		return errDec
+	}
 
-	log.Printf("%s: reading group=%s YAML from stdin...", caller, name)
+	if errExpand := gr.expand("."); errExpand != nil {
+		return errExpand
+	}
+
+	return nil
+}
+
+// groupFromFile loads group from YAML file, expanding templates.
+// Path "-" means stdin.
+func groupFromFile(caller, path string, gr *group) error {
+	if path == "-" {
+		return groupFromStdin(caller, path, gr)
+	}
+
+	if errRead := readGroupFile(caller, path, gr); errRead != nil {
+		return errRead
+	}
+
+	return gr.expand(filepath.Dir(path))
+}
+
+// readGroupFile loads group from YAML file, keeping templates unexpanded.
+// Path "-" means stdin.
+func readGroupFile(caller, path string, gr *group) error {
+	if path == "-" {
+		slog.Debug("reading group YAML from stdin")
+		return groupFromReader(os.Stdin, gr)
+	}
+
+	slog.Debug("reading group YAML", "file", path)
+
+	f, errOpen := os.Open(path)
+	if errOpen != nil {
+		return errOpen
+	}
+	defer f.Close()
+
+	return groupFromReader(f, gr)
+}
+
+func groupFromReader(r io.Reader, gr *group) error {
+	dec := yaml.NewDecoder(bufio.NewReader(r))
 
 	errDec := dec.Decode(gr)
 	if errDec != nil && errDec != io.EOF {
 		return errDec
 	}
 
-	log.Printf("%s: reading group=%s YAML from stdin...done", caller, name)
+	_, errMigrate := gr.migrate()
 
-	return nil
+	return errMigrate
+}
+
+// groupFromCloud fetches group from cloud provider.
+// args holds the same positional arguments as the pull command.
+func groupFromCloud(me, cloud string, args []string) (*group, error) {
+	switch cloud {
+	case "aws":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%s: %s: missing name vpc-id", me, cloud)
+		}
+		return fetchAws(args[0], args[1])
+	case "azure":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%s: %s: missing name resource-group", me, cloud)
+		}
+		return fetchAzure(args[0], args[1])
+	case "openstack":
+		if len(args) < 1 {
+			return nil, fmt.Errorf("%s: %s: missing name", me, cloud)
+		}
+		return fetchOpenstack(args[0])
+	}
+	return nil, fmt.Errorf("%s: cloud not supported: %s", me, cloud)
+}
+
+// groupFromSource loads group either from cloud provider or from file.
+// args is "cloud name scope..." or "file".
+func groupFromSource(me string, args []string) (*group, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%s: missing file or cloud", me)
+	}
+	if isCloud(args[0]) {
+		return groupFromCloud(me, args[0], args[1:])
+	}
+	gr := &group{}
+	if errLoad := groupFromFile(me, args[0], gr); errLoad != nil {
+		return nil, errLoad
+	}
+	return gr, nil
+}
+
+func isCloud(s string) bool {
+	switch s {
+	case "aws", "azure", "openstack":
+		return true
+	}
+	return false
+}
+
+// eachRule calls fn for every rule, inbound first.
+// Direction is in|out, index is position within RulesIn/RulesOut.
+func (g *group) eachRule(fn func(dir string, i int, r *rule)) {
+	for i := range g.RulesIn {
+		fn("in", i, &g.RulesIn[i])
+	}
+	for i := range g.RulesOut {
+		fn("out", i, &g.RulesOut[i])
+	}
+}
+
+// ruleLoc formats rule position as in YAML file, such as RulesIn[2].
+func ruleLoc(dir string, i int) string {
+	if dir == "out" {
+		return fmt.Sprintf("RulesOut[%d]", i)
+	}
+	return fmt.Sprintf("RulesIn[%d]", i)
 }
 
 func (g *group) output() {
-	buf, errDump := yaml.Marshal(g)
+	buf, errDump := g.yaml()
 	if errDump != nil {
-		log.Printf("output: %v", errDump)
+		slog.Error("group output", "error", errDump)
+	}
+	fmt.Print(string(buf))
+}
+
+// yaml marshals group under current schema header.
+func (g *group) yaml() ([]byte, error) {
+	g.APIVersion = schemaAPIVersion
+	g.Kind = schemaKind
+	return yaml.Marshal(g)
+}
+
+// groupRef addresses a live group as cloud:name@scope.
+// Scope is vpc-id for aws, resource-group[/location] for azure and
+// optional region for openstack.
+type groupRef struct {
+	cloud    string
+	name     string
+	scope    string
+	location string // azure location for push
+}
+
+// parseGroupRef parses cloud:name@scope.
+// Returns false when s is not a group reference (a file name).
+func parseGroupRef(s string) (groupRef, bool) {
+	i := strings.Index(s, ":")
+	if i < 0 || !isCloud(s[:i]) {
+		return groupRef{}, false
+	}
+	ref := groupRef{cloud: s[:i], name: s[i+1:]}
+	if j := strings.LastIndex(ref.name, "@"); j >= 0 {
+		ref.name, ref.scope = ref.name[:j], ref.name[j+1:]
+	}
+	if ref.cloud == "azure" {
+		if j := strings.Index(ref.scope, "/"); j >= 0 {
+			ref.scope, ref.location = ref.scope[:j], ref.scope[j+1:]
+		}
+	}
+	return ref, true
+}
+
+func (ref groupRef) String() string {
+	s := ref.cloud + ":" + ref.name
+	if ref.scope != "" {
+		s += "@" + ref.scope
+	}
+	if ref.location != "" {
+		s += "/" + ref.location
+	}
+	return s
+}
+
+// pullArgs returns positional arguments as taken by pull command.
+func (ref groupRef) pullArgs() []string {
+	args := []string{ref.name}
+	if ref.scope != "" {
+		args = append(args, ref.scope)
+	}
+	return args
+}
+
+// refFromArgs builds group ref from positional arguments "cloud name scope".
+func refFromArgs(args []string) (groupRef, error) {
+	if len(args) < 1 || !isCloud(args[0]) {
+		return groupRef{}, fmt.Errorf("missing cloud: aws|azure|openstack")
+	}
+	ref := groupRef{cloud: args[0]}
+	switch ref.cloud {
+	case "aws":
+		if len(args) < 3 {
+			return ref, fmt.Errorf("missing name vpc-id")
+		}
+		ref.name, ref.scope = args[1], args[2]
+	case "azure":
+		if len(args) < 3 {
+			return ref, fmt.Errorf("missing name resource-group")
+		}
+		ref.name, ref.scope = args[1], args[2]
+	case "openstack":
+		if len(args) < 2 {
+			return ref, fmt.Errorf("missing name")
+		}
+		ref.name = args[1]
+		if len(args) > 2 {
+			ref.scope = args[2] // region
+		}
+	}
+	return ref, nil
+}
+
+// setRegion selects openstack region given as scope.
+func (ref groupRef) setRegion() {
+	if ref.cloud == "openstack" && ref.scope != "" {
+		os.Setenv("OS_REGION_NAME", ref.scope)
+	}
+}
+
+// groupFromLocation loads group from cloud:name@scope reference or from file.
+func groupFromLocation(me, location string) (*group, error) {
+	if ref, isRef := parseGroupRef(location); isRef {
+		ref.setRegion()
+		return groupFromCloud(me, ref.cloud, ref.pullArgs())
 	}
-	fmt.Printf(string(buf))
+	return groupFromSource(me, []string{location})
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// icmpPull maps provider type/code pair to rule fields.
+// AWS uses -1 for any type or code.
+func icmpPull(icmpType, icmpCode int64) (*int64, *int64) {
+	var t, c *int64
+	if icmpType >= 0 {
+		t = &icmpType
+	}
+	if icmpCode >= 0 {
+		c = &icmpCode
+	}
+	return t, c
+}
+
+// icmpPullOpenstack maps neutron port range to ICMP type/code.
+// Null means any.
+func icmpPullOpenstack(min, max *int) (*int64, *int64) {
+	if min == nil {
+		return nil, nil
+	}
+	t := int64(*min)
+	if max == nil {
+		return &t, nil
+	}
+	c := int64(*max)
+	return &t, &c
+}
+
+// icmpPush maps rule fields to provider type/code pair, -1 meaning any.
+func icmpPush(r rule) (int64, int64) {
+	icmpType, icmpCode := int64(-1), int64(-1)
+	if r.IcmpType != nil {
+		icmpType = *r.IcmpType
+	}
+	if r.IcmpCode != nil {
+		icmpCode = *r.IcmpCode
+	}
+	return icmpType, icmpCode
+}
+
+func icmpString(v *int64) string {
+	if v == nil {
+		return "any"
+	}
+	return fmt.Sprint(*v)
+}
+
+// icmpWarnings reports ICMP type/code the target cloud cannot express.
+func icmpWarnings(cloud string, gr *group) []string {
+	var warnings []string
+
+	gr.eachRule(func(dir string, i int, r *rule) {
+		if r.IcmpType == nil && r.IcmpCode == nil {
+			return
+		}
+		loc := ruleLoc(dir, i)
+		if !protoIcmp(r.Protocol) {
+			warnings = append(warnings, fmt.Sprintf("%s: ICMP type/code ignored for protocol=%s", loc, r.Protocol))
+			return
+		}
+		switch {
+		case cloud == "azure":
+			warnings = append(warnings, fmt.Sprintf("%s: azure cannot express ICMP type=%s code=%s: rule allows all ICMP",
+				loc, icmpString(r.IcmpType), icmpString(r.IcmpCode)))
+		case r.IcmpType == nil:
+			warnings = append(warnings, fmt.Sprintf("%s: %s cannot express ICMP code=%s without type: rule allows all ICMP",
+				loc, cloud, icmpString(r.IcmpCode)))
+		}
+	})
+
+	return warnings
+}
+
+func logIcmpWarnings(me, cloud, name string, gr *group) {
+	for _, w := range icmpWarnings(cloud, gr) {
+		slog.Warn(w, "cloud", cloud, "group", name)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func intPtr(v int) *int { return &v }
+
+// TestIcmpOpenstack checks ICMP type/code reach neutron port range,
+// 0 included, and come back unchanged on pull.
+func TestIcmpOpenstack(t *testing.T) {
+	table := []struct {
+		name     string
+		icmpType *int64
+		icmpCode *int64
+		wantMin  *int // nil means field absent, any
+		wantMax  *int
+	}{
+		{"echo request 8/0", int64Ptr(8), int64Ptr(0), intPtr(8), intPtr(0)},
+		{"echo reply 0/0", int64Ptr(0), int64Ptr(0), intPtr(0), intPtr(0)},
+		{"unreachable 3/any", int64Ptr(3), nil, intPtr(3), nil},
+		{"unreachable 3/1", int64Ptr(3), int64Ptr(1), intPtr(3), intPtr(1)},
+		{"any", nil, nil, nil, nil},
+	}
+
+	for _, data := range table {
+		r := rule{Protocol: "icmp", IcmpType: data.icmpType, IcmpCode: data.icmpCode}
+
+		createOpts := createRuleOpenstack(r, "group-id", block{Address: "0.0.0.0/0"}, rules.EtherType4, rules.DirIngress)
+		b, errBody := createOpts.ToSecGroupRuleCreateMap()
+		if errBody != nil {
+			t.Fatalf("%s: %v", data.name, errBody)
+		}
+		body := b["security_group_rule"].(map[string]interface{})
+
+		for _, field := range []struct {
+			key  string
+			want *int
+		}{{"port_range_min", data.wantMin}, {"port_range_max", data.wantMax}} {
+			got, found := body[field.key]
+			switch {
+			case field.want == nil && found:
+				t.Errorf("%s: %s=%v, want absent", data.name, field.key, got)
+			case field.want != nil && !found:
+				t.Errorf("%s: %s absent, want %d", data.name, field.key, *field.want)
+			case field.want != nil && fmt.Sprint(got) != fmt.Sprint(*field.want):
+				t.Errorf("%s: %s=%v, want %d", data.name, field.key, got, *field.want)
+			}
+		}
+
+		pullType, pullCode := icmpPullOpenstack(data.wantMin, data.wantMax)
+		if icmpString(pullType) != icmpString(data.icmpType) || icmpString(pullCode) != icmpString(data.icmpCode) {
+			t.Errorf("%s: pulled type=%s code=%s", data.name, icmpString(pullType), icmpString(pullCode))
+		}
+	}
+}
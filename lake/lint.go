@@ -0,0 +1,563 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityNote    = "note"
+	severityOff     = "off"
+)
+
+const (
+	lintOpenSensitivePort = "open-sensitive-port"
+	lintAllTrafficPublic  = "all-traffic-public"
+	lintWidePortRange     = "wide-port-range"
+	lintShadowedRule      = "shadowed-rule"
+	lintAzureShadowed     = "azure-shadowed-allow"
+	lintDuplicateBlock    = "duplicate-block"
+	lintOverlappingBlock  = "overlapping-block"
+)
+
+// lintPolicy is loaded from YAML policy file.
+type lintPolicy struct {
+	Rules map[string]lintRuleConfig
+}
+
+type lintRuleConfig struct {
+	Severity string
+	Ports    []int64 // open-sensitive-port
+	MaxPorts int64   // wide-port-range
+}
+
+type lintFinding struct {
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Direction string `json:"direction"`
+	Index     int    `json:"index"`
+	Message   string `json:"message"`
+}
+
+func defaultLintPolicy() lintPolicy {
+	return lintPolicy{
+		Rules: map[string]lintRuleConfig{
+			lintOpenSensitivePort: {
+				Severity: severityError,
+				// ssh, rdp, mssql, oracle, mysql, postgresql, redis, elasticsearch, mongodb
+				Ports: []int64{22, 3389, 1433, 1521, 3306, 5432, 6379, 9200, 27017},
+			},
+			lintAllTrafficPublic: {Severity: severityError},
+			lintWidePortRange:    {Severity: severityWarning, MaxPorts: 1024},
+			lintShadowedRule:     {Severity: severityWarning},
+			lintAzureShadowed:    {Severity: severityWarning},
+			lintDuplicateBlock:   {Severity: severityWarning},
+			lintOverlappingBlock: {Severity: severityNote},
+		},
+	}
+}
+
+// loadLintPolicy overrides default policy with settings from file.
+func loadLintPolicy(path string) (lintPolicy, error) {
+	policy := defaultLintPolicy()
+	if path == "" {
+		return policy, nil
+	}
+
+	buf, errRead := os.ReadFile(path)
+	if errRead != nil {
+		return policy, errRead
+	}
+
+	var custom lintPolicy
+	if errYaml := yaml.Unmarshal(buf, &custom); errYaml != nil {
+		return policy, fmt.Errorf("lint policy: %s: %v", path, errYaml)
+	}
+
+	for name, c := range custom.Rules {
+		def, found := policy.Rules[name]
+		if !found {
+			return policy, fmt.Errorf("lint policy: %s: unknown rule: %s", path, name)
+		}
+		switch c.Severity {
+		case "":
+		case severityError, severityWarning, severityNote, severityOff:
+			def.Severity = c.Severity
+		default:
+			return policy, fmt.Errorf("lint policy: %s: rule %s: bad severity: %s", path, name, c.Severity)
+		}
+		if c.Ports != nil {
+			def.Ports = c.Ports
+		}
+		if c.MaxPorts > 0 {
+			def.MaxPorts = c.MaxPorts
+		}
+		policy.Rules[name] = def
+	}
+
+	return policy, nil
+}
+
+func cmdLint(me string, args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	policyFile := fs.String("policy", "", "YAML lint policy file")
+	format := fs.String("format", "text", "output format: text|json|sarif")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	policy, errPolicy := loadLintPolicy(*policyFile)
+	if errPolicy != nil {
+		return errPolicy
+	}
+
+	gr, errLoad := groupFromSource(me, positional)
+	if errLoad != nil {
+		return errLoad
+	}
+
+	findings := gr.lint(policy)
+
+	switch *format {
+	case "text":
+		for _, f := range findings {
+			fmt.Printf("%s %s %s: %s\n", f.Severity, f.Rule, f.location(), f.Message)
+		}
+	case "json":
+		if errJSON := writeJSON(findings); errJSON != nil {
+			return errJSON
+		}
+	case "sarif":
+		if errSarif := writeJSON(sarifFromFindings(findings, strings.Join(positional, " "))); errSarif != nil {
+			return errSarif
+		}
+	default:
+		return fmt.Errorf("lint: bad format: %s", *format)
+	}
+
+	var errors int
+	for _, f := range findings {
+		if f.Severity == severityError {
+			errors++
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("lint: %d error(s)", errors)
+	}
+
+	return nil
+}
+
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (f lintFinding) location() string {
+	return ruleLoc(f.Direction, f.Index)
+}
+
+// lint scans group for risky patterns.
+func (g *group) lint(policy lintPolicy) []lintFinding {
+	var findings []lintFinding
+
+	report := func(name, direction string, index int, format string, a ...interface{}) {
+		severity := policy.Rules[name].Severity
+		if severity == severityOff || severity == "" {
+			return
+		}
+		findings = append(findings, lintFinding{
+			Rule:      name,
+			Severity:  severity,
+			Direction: direction,
+			Index:     index,
+			Message:   fmt.Sprintf(format, a...),
+		})
+	}
+
+	g.eachRule(func(dir string, i int, r *rule) {
+		lintRule(policy, report, dir, i, *r)
+	})
+	lintShadow(report, "in", g.RulesIn)
+	lintShadow(report, "out", g.RulesOut)
+
+	return findings
+}
+
+type lintReport func(name, direction string, index int, format string, a ...interface{})
+
+func lintRule(policy lintPolicy, report lintReport, direction string, index int, r rule) {
+	if r.deny() {
+		return // deny rules do not open holes
+	}
+
+	blocks := append(append([]block{}, r.Blocks...), r.BlocksV6...)
+
+	for _, b := range blocks {
+		if !blockIsWorld(b.Address) {
+			continue
+		}
+		var ports []string
+		for _, p := range policy.Rules[lintOpenSensitivePort].Ports {
+			if r.matchProtoPort("tcp", p) || r.matchProtoPort("udp", p) {
+				ports = append(ports, fmt.Sprint(p))
+			}
+		}
+		if len(ports) > 0 {
+			report(lintOpenSensitivePort, direction, index, "%s allowed to sensitive port(s) %s", b.Address, strings.Join(ports, ","))
+		}
+	}
+
+	if protoAny(r.Protocol) && r.portsAny() {
+		for _, b := range blocks {
+			if blockIsPublic(b.Address) {
+				report(lintAllTrafficPublic, direction, index, "all traffic allowed from public block %s", b.Address)
+			}
+		}
+	}
+
+	if max := policy.Rules[lintWidePortRange].MaxPorts; max > 0 && !r.portsAny() && !protoIcmp(r.Protocol) {
+		if size := r.PortLast - r.PortFirst + 1; size > max {
+			report(lintWidePortRange, direction, index, "port range %d-%d spans %d ports (max %d)", r.PortFirst, r.PortLast, size, max)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, b := range blocks {
+		if seen[b.Address] {
+			report(lintDuplicateBlock, direction, index, "duplicate block %s", b.Address)
+		}
+		seen[b.Address] = true
+	}
+
+	for i, inner := range blocks {
+		for j, outer := range blocks {
+			if i == j || inner.Address == outer.Address {
+				continue
+			}
+			if blockCovers(outer.Address, inner.Address) {
+				report(lintOverlappingBlock, direction, index, "block %s is contained in block %s", inner.Address, outer.Address)
+				break
+			}
+		}
+	}
+}
+
+// lintShadow finds rules fully covered by another rule.
+// For ordered (Azure) rules only higher priority rules can shadow.
+func lintShadow(report lintReport, direction string, ruleList []rule) {
+	ordered := isOrdered(ruleList)
+
+	indices := make([]int, len(ruleList))
+	for i := range indices {
+		indices[i] = i
+	}
+	if ordered {
+		sort.SliceStable(indices, func(i, j int) bool {
+			return ruleList[indices[i]].azure().Priority < ruleList[indices[j]].azure().Priority
+		})
+	}
+
+	for pos, i := range indices {
+		r := ruleList[i]
+		for prev, j := range indices {
+			if prev == pos {
+				continue
+			}
+			other := ruleList[j]
+			if !ruleCovers(other, r) {
+				continue
+			}
+			if prev > pos && (ordered || ruleCovers(r, other)) {
+				continue // only higher priority rule, or first of equivalent rules, shadows
+			}
+			if ordered && other.deny() && !r.deny() {
+				report(lintAzureShadowed, direction, i, "allow rule %s (priority %d) is fully shadowed by deny rule %s (priority %d)",
+					r.azure().Name, r.azure().Priority, other.azure().Name, other.azure().Priority)
+				break
+			}
+			report(lintShadowedRule, direction, i, "rule is fully covered by rule %d", j)
+			break
+		}
+	}
+}
+
+// ruleCovers reports whether rule outer matches all traffic matched by rule inner.
+func ruleCovers(outer, inner rule) bool {
+	if !protoAny(outer.Protocol) && !protoEqual(outer.Protocol, inner.Protocol) {
+		return false
+	}
+	if !outer.portsAny() && !protoIcmp(outer.Protocol) {
+		if inner.portsAny() || inner.PortFirst < outer.PortFirst || inner.PortLast > outer.PortLast {
+			return false
+		}
+	}
+	if protoIcmp(outer.Protocol) && !icmpCovers(outer, inner) {
+		return false
+	}
+	if !azureFiltersCover(outer, inner) {
+		return false
+	}
+	outerBlocks := append(append([]block{}, outer.Blocks...), outer.BlocksV6...)
+	innerBlocks := append(append([]block{}, inner.Blocks...), inner.BlocksV6...)
+	if len(innerBlocks) < 1 {
+		return false
+	}
+	for _, ib := range innerBlocks {
+		var covered bool
+		for _, ob := range outerBlocks {
+			if blockCovers(ob.Address, ib.Address) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// azureFiltersCover reports whether azure destination prefixes and source
+// ports of rule outer include those of rule inner.
+func azureFiltersCover(outer, inner rule) bool {
+	if outerDst := outer.azureDestinations(); outerDst != nil {
+		innerDst := inner.azureDestinations()
+		if innerDst == nil {
+			return false
+		}
+		for _, i := range innerDst {
+			var covered bool
+			for _, o := range outerDst {
+				if blockCovers(o, i) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	if outerSrc := outer.azureSourcePorts(); outerSrc != nil {
+		innerSrc := inner.azureSourcePorts()
+		if innerSrc == nil {
+			return false
+		}
+		for _, i := range innerSrc {
+			if !portRangeListCovers(outerSrc, i) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// portRangeListCovers reports whether port range inner is within one of ranges.
+func portRangeListCovers(ranges []string, inner string) bool {
+	innerFirst, innerLast, errInner := parsePortRange(inner)
+	if errInner != nil {
+		return false
+	}
+	for _, o := range ranges {
+		first, last, errOuter := parsePortRange(o)
+		if errOuter == nil && first <= innerFirst && innerLast <= last {
+			return true
+		}
+	}
+	return false
+}
+
+func icmpCovers(outer, inner rule) bool {
+	if outer.IcmpType != nil && (inner.IcmpType == nil || *inner.IcmpType != *outer.IcmpType) {
+		return false
+	}
+	if outer.IcmpCode != nil && (inner.IcmpCode == nil || *inner.IcmpCode != *outer.IcmpCode) {
+		return false
+	}
+	return true
+}
+
+// blockCovers reports whether block outer contains block inner.
+func blockCovers(outer, inner string) bool {
+	if outer == "*" {
+		return true
+	}
+	if outer == inner {
+		return true
+	}
+	o, errOuter := blockNet(outer)
+	if errOuter != nil {
+		return false
+	}
+	i, errInner := blockNet(inner)
+	if errInner != nil {
+		return false
+	}
+	return netCovers(o, i)
+}
+
+func netCovers(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	if outerBits != innerBits {
+		return false
+	}
+	return outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+// blockIsWorld reports whether block matches every address.
+func blockIsWorld(address string) bool {
+	switch strings.ToLower(address) {
+	case "*", "any", "internet":
+		return true
+	}
+	n, errNet := blockNet(address)
+	if errNet != nil {
+		return false
+	}
+	ones, _ := n.Mask.Size()
+	return ones == 0
+}
+
+var privateNets = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"fc00::/7",
+	"fe80::/10",
+	"::1/128",
+}
+
+// blockIsPublic reports whether block reaches beyond private ranges.
+func blockIsPublic(address string) bool {
+	if blockIsWorld(address) {
+		return true
+	}
+	n, errNet := blockNet(address)
+	if errNet != nil {
+		return false // service tags like VirtualNetwork
+	}
+	for _, p := range privateNets {
+		_, private, _ := net.ParseCIDR(p)
+		if netCovers(private, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// SARIF 2.1.0 minimal log
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+func sarifFromFindings(findings []lintFinding, source string) sarifLog {
+	var ruleIDs []string
+	for name := range defaultLintPolicy().Rules {
+		ruleIDs = append(ruleIDs, name)
+	}
+	sort.Strings(ruleIDs)
+
+	driver := sarifDriver{
+		Name:           "lake",
+		InformationURI: "https://github.com/udhos/lavalake",
+	}
+	for _, id := range ruleIDs {
+		driver.Rules = append(driver.Rules, sarifRule{ID: id})
+	}
+
+	results := []sarifResult{}
+	for _, f := range findings {
+		loc := sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: f.location()}},
+		}
+		if source != "" && !isCloud(strings.Fields(source)[0]) {
+			loc.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: source},
+			}
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.Rule,
+			Level:     f.Severity,
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{loc},
+		})
+	}
+
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{
+			{
+				Tool:    sarifTool{Driver: driver},
+				Results: results,
+			},
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestRuleCoversAzureFilters(t *testing.T) {
+	web := func(dst []string, srcPorts []string) rule {
+		return rule{
+			Protocol:  "tcp",
+			PortFirst: 0,
+			PortLast:  65535,
+			Blocks:    []block{{Address: "10.0.0.0/8"}},
+			Azure:     &ruleAzure{Name: "r", Priority: 100, DestinationAddressPrefixes: dst, SourcePortRanges: srcPorts},
+		}
+	}
+
+	table := []struct {
+		name  string
+		outer rule
+		inner rule
+		want  bool
+	}{
+		{"no filters", web(nil, nil), web(nil, nil), true},
+		{"outer any destination", web([]string{"*"}, nil), web([]string{"10.1.0.0/16"}, nil), true},
+		{"other destination", web([]string{"10.1.0.0/16"}, nil), web([]string{"10.2.0.0/16"}, nil), false},
+		{"wider destination", web([]string{"10.0.0.0/8"}, nil), web([]string{"10.2.0.0/16", "10.3.0.4"}, nil), true},
+		{"inner any destination", web([]string{"10.1.0.0/16"}, nil), web(nil, nil), false},
+		{"service tag destination", web([]string{"VirtualNetwork"}, nil), web([]string{"VirtualNetwork"}, nil), true},
+		{"other source ports", web(nil, []string{"1024-2047"}), web(nil, []string{"3000"}), false},
+		{"wider source ports", web(nil, []string{"1024-65535", "80"}), web(nil, []string{"2000-3000", "80"}), true},
+		{"inner any source port", web(nil, []string{"1024-65535"}), web(nil, []string{"*"}), false},
+	}
+
+	for _, data := range table {
+		if got := ruleCovers(data.outer, data.inner); got != data.want {
+			t.Errorf("%s: covers=%v, want %v", data.name, got, data.want)
+		}
+	}
+}
+
+func TestLintShadowAzureDestination(t *testing.T) {
+	deny := rule{
+		Protocol: "tcp", PortFirst: 0, PortLast: 65535,
+		Blocks: []block{{Address: "0.0.0.0/0"}},
+		Azure:  &ruleAzure{Name: "deny-db", Priority: 100, Deny: true, DestinationAddressPrefix: "10.9.0.0/16"},
+	}
+	allow := rule{
+		Protocol: "tcp", PortFirst: 443, PortLast: 443,
+		Blocks: []block{{Address: "10.0.0.0/8"}},
+		Azure:  &ruleAzure{Name: "web", Priority: 200, DestinationAddressPrefix: "10.1.0.0/16"},
+	}
+
+	gr := group{RulesIn: []rule{deny, allow}}
+	for _, f := range gr.lint(defaultLintPolicy()) {
+		if f.Rule == lintShadowedRule || f.Rule == lintAzureShadowed {
+			t.Errorf("unexpected finding: %s %s: %s", f.Rule, f.location(), f.Message)
+		}
+	}
+
+	// same destination is shadowed
+	gr.RulesIn[1].Azure.DestinationAddressPrefix = "10.9.1.0/24"
+	var found bool
+	for _, f := range gr.lint(defaultLintPolicy()) {
+		found = found || f.Rule == lintAzureShadowed
+	}
+	if !found {
+		t.Errorf("missing %s finding", lintAzureShadowed)
+	}
+}
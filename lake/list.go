@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// listOptions holds flags shared by list commands.
+type listOptions struct {
+	usage  bool   // show where each group is attached
+	format string // table|json|yaml|csv
+}
+
+func parseListFlags(args []string) (listOptions, []string, error) {
+	var opts listOptions
+
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.BoolVar(&opts.usage, "usage", false, "show where each group is attached")
+	fs.StringVar(&opts.format, "format", "table", "output format: table|json|yaml|csv")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return opts, nil, errFlags
+	}
+
+	switch opts.format {
+	case "table", "json", "yaml", "csv":
+	default:
+		return opts, nil, fmt.Errorf("list: bad format: %s", opts.format)
+	}
+
+	return opts, positional, nil
+}
+
+// groupRecord is the list output schema common to all clouds.
+type groupRecord struct {
+	Cloud            string            `json:"cloud" yaml:"cloud"`
+	Scope            string            `json:"scope" yaml:"scope"` // aws vpc-id, azure resource group, openstack region
+	Name             string            `json:"name" yaml:"name"`
+	ID               string            `json:"id" yaml:"id"`
+	Description      string            `json:"description" yaml:"description"`
+	RulesIn          int               `json:"rulesIn" yaml:"rulesIn"`   // provider ingress rules
+	RulesOut         int               `json:"rulesOut" yaml:"rulesOut"` // provider egress rules
+	Tags             map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Extra            map[string]string `json:"extra,omitempty" yaml:"extra,omitempty"` // provider specific fields
+	Attachments      []attachment      `json:"attachments,omitempty" yaml:"attachments,omitempty"`
+	AttachmentsError string            `json:"attachmentsError,omitempty" yaml:"attachmentsError,omitempty"`
+}
+
+func (rec *groupRecord) setAttachments(list []attachment, errAttach error) {
+	rec.Attachments = list
+	if errAttach != nil {
+		rec.AttachmentsError = errAttach.Error()
+	}
+}
+
+// writeRecords writes list output to stdout.
+func writeRecords(format string, records []groupRecord) error {
+	switch format {
+	case "json":
+		if records == nil {
+			records = []groupRecord{}
+		}
+		return writeJSON(records)
+	case "yaml":
+		buf, errYaml := yaml.Marshal(records)
+		if errYaml != nil {
+			return errYaml
+		}
+		fmt.Print(string(buf))
+		return nil
+	case "csv":
+		return writeRecordsCSV(records)
+	}
+	return writeRecordsTable(records)
+}
+
+func writeRecordsTable(records []groupRecord) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLOUD\tSCOPE\tNAME\tID\tIN\tOUT\tDESCRIPTION")
+	for _, rec := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", rec.Cloud, rec.Scope, rec.Name, rec.ID, rec.RulesIn, rec.RulesOut, rec.Description)
+		if rec.AttachmentsError != "" {
+			fmt.Fprintf(w, "\t\t\t\t\t\tattachments: error: %s\n", rec.AttachmentsError)
+		}
+		for _, a := range rec.Attachments {
+			fmt.Fprintf(w, "\t\t\t\t\t\tattached: %s\n", a)
+		}
+	}
+	return w.Flush()
+}
+
+func writeRecordsCSV(records []groupRecord) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"cloud", "scope", "name", "id", "description", "rules_in", "rules_out", "tags", "extra", "attachments"})
+	for _, rec := range records {
+		var attachments []string
+		for _, a := range rec.Attachments {
+			attachments = append(attachments, a.Kind+"="+a.ID)
+		}
+		w.Write([]string{
+			rec.Cloud,
+			rec.Scope,
+			rec.Name,
+			rec.ID,
+			rec.Description,
+			strconv.Itoa(rec.RulesIn),
+			strconv.Itoa(rec.RulesOut),
+			joinMap(rec.Tags),
+			joinMap(rec.Extra),
+			strings.Join(attachments, ";"),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// joinMap formats map as sorted "k=v;k=v".
+func joinMap(m map[string]string) string {
+	var list []string
+	for k, v := range m {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ";")
+}
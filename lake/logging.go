@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// globalOptions holds global flags, accepted anywhere in command line.
+type globalOptions struct {
+	format  string        // log format: text|json
+	verbose bool          // debug level
+	quiet   bool          // warnings and errors only
+	timeout time.Duration // bound for whole command, zero means none
+	retries int           // retries per cloud call for throttled and transient errors
+}
+
+// parseGlobalFlags removes global flags from args.
+// Global flags may appear before or after the command.
+func parseGlobalFlags(args []string) (globalOptions, []string, error) {
+	opts := globalOptions{format: "text", timeout: defaultTimeout, retries: defaultRetries}
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-v", "--v", "-verbose", "--verbose":
+			opts.verbose = true
+			continue
+		case "-q", "--q", "-quiet", "--quiet":
+			opts.quiet = true
+			continue
+		}
+
+		name, value, found, errValue := globalValue(args, &i)
+		if errValue != nil {
+			return opts, nil, errValue
+		}
+		if !found {
+			rest = append(rest, arg)
+			continue
+		}
+
+		switch name {
+		case "log-format":
+			opts.format = value
+		case "timeout":
+			d, errParse := parseTimeout(value)
+			if errParse != nil {
+				return opts, nil, errParse
+			}
+			opts.timeout = d
+		case "retries":
+			n, errConv := strconv.Atoi(value)
+			if errConv != nil || n < 0 {
+				return opts, nil, fmt.Errorf("bad retries: %s", value)
+			}
+			opts.retries = n
+		}
+	}
+	return opts, rest, nil
+}
+
+// globalValueFlags are global flags taking a value.
+var globalValueFlags = []string{"log-format", "timeout", "retries"}
+
+// globalValue matches args[*i] as global flag with value, either
+// "--name value" or "--name=value", advancing *i past the value.
+func globalValue(args []string, i *int) (string, string, bool, error) {
+	arg := args[*i]
+	for _, name := range globalValueFlags {
+		for _, prefix := range []string{"-", "--"} {
+			flag := prefix + name
+			if strings.HasPrefix(arg, flag+"=") {
+				return name, arg[len(flag)+1:], true, nil
+			}
+			if arg == flag {
+				if *i+1 >= len(args) {
+					return name, "", false, fmt.Errorf("flag needs an argument: %s", arg)
+				}
+				*i++
+				return name, args[*i], true, nil
+			}
+		}
+	}
+	return "", "", false, nil
+}
+
+// setupLogging installs default structured logger on stderr.
+// Env var DEBUG enables debug level as -v does.
+func setupLogging(opts globalOptions) error {
+	level := slog.LevelInfo
+	switch {
+	case opts.quiet:
+		level = slog.LevelWarn
+	case opts.verbose || os.Getenv("DEBUG") != "":
+		level = slog.LevelDebug
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactSecrets}
+
+	var handler slog.Handler
+	switch opts.format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	default:
+		return fmt.Errorf("bad log format: %s", opts.format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+// secretWords mark attribute keys whose values are never logged.
+var secretWords = []string{"password", "secret", "token", "credential"}
+
+func redactSecrets(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, w := range secretWords {
+		if strings.Contains(key, w) {
+			return slog.String(a.Key, "<hidden>")
+		}
+	}
+	return a
+}
@@ -2,61 +2,159 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 )
 
-var debug bool
+func usage(me string) {
+	fmt.Printf("usage:   %s list|pull|push cloud [args]\n", me)
+	fmt.Printf("usage:   %s query|lint|optimize file|cloud [args] [flags]\n", me)
+	fmt.Printf("usage:   %s diff file|cloud:name@scope file|cloud:name@scope [--format json]\n", me)
+	fmt.Printf("usage:   %s copy file|cloud:name@scope cloud:name@scope [--dry-run] [push flags]\n", me)
+	fmt.Printf("usage:   %s sync manifest.yaml [--dry-run] [--prune] [push flags]\n", me)
+	fmt.Printf("usage:   %s clone cloud name new-name [scope] [push flags]\n", me)
+	fmt.Printf("usage:   %s rename openstack name new-name [region]\n", me)
+	fmt.Printf("usage:   %s usage cloud name [scope]\n", me)
+	fmt.Printf("usage:   %s search cloud [scope]|dir [--cidr X] [--port P] [--proto P] [--name-glob G]\n", me)
+	fmt.Printf("usage:   %s delete cloud name [scope] --yes\n", me)
+	fmt.Printf("usage:   %s migrate file... [--in-place]\n", me)
+	fmt.Printf("usage:   %s render file\n", me)
+	fmt.Println()
+	fmt.Printf("example: %s list aws\n", me)
+	fmt.Printf("example: %s pull aws group1 vpc-id > group1.yaml\n", me)
+	fmt.Printf("example: %s push aws group2 vpc-id < group2.yaml\n", me)
+	fmt.Println()
+	fmt.Printf("example: %s list azure\n", me)
+	fmt.Printf("example: %s pull azure group1 resource-group-name > group1.yaml\n", me)
+	fmt.Printf("example: %s push azure group2 resource-group-name location < group1.yaml\n", me)
+	fmt.Println()
+	fmt.Printf("example: %s list openstack\n", me)
+	fmt.Printf("example: %s pull openstack group1 > group1.yaml\n", me)
+	fmt.Printf("example: %s push openstack group2 < group1.yaml\n", me)
+	fmt.Println()
+	fmt.Printf("global flags: -v (debug) -q (warnings only) --log-format text|json --timeout 10m --retries 4\n")
+	fmt.Printf("list flags: --usage --format table|json|yaml|csv\n")
+	fmt.Printf("pull flags: --services\n")
+	fmt.Printf("push flags: --policy org-policy.yaml --override reason --optimize --split --workers 8\n")
+	fmt.Println()
+	fmt.Printf("example: %s query group1.yaml --src 10.1.2.3 --port 5432 --proto tcp\n", me)
+	fmt.Printf("example: %s query aws group1 vpc-id --src 10.1.2.3 --port 5432\n", me)
+	fmt.Printf("example: %s lint group1.yaml --policy lint-policy.yaml --format sarif\n", me)
+	fmt.Printf("example: %s search aws vpc-id --cidr 0.0.0.0/0 --port 22 --proto tcp --name-glob 'web-*'\n", me)
+	fmt.Printf("example: %s diff aws:group1@vpc-id azure:group1@resource-group-name\n", me)
+	fmt.Printf("example: %s copy aws:group1@vpc-id azure:group1@resource-group-name/westeurope\n", me)
+}
 
 func main() {
+	os.Exit(run())
+}
+
+// run executes command and returns exit status.
+// Deferred cleanup runs before main exits.
+func run() int {
 	me := os.Args[0]
 
-	if len(os.Args) < 3 {
-		fmt.Printf("%s: insufficient arguments\n", me)
-		fmt.Println()
-		fmt.Printf("usage:   %s list|pull|push cloud [args]\n", me)
-		fmt.Println()
-		fmt.Printf("example: %s list aws\n", me)
-		fmt.Printf("example: %s pull aws group1 vpc-id > group1.yaml\n", me)
-		fmt.Printf("example: %s push aws group2 vpc-id < group2.yaml\n", me)
+	globalOpts, args, errGlobal := parseGlobalFlags(os.Args[1:])
+	if errGlobal != nil {
+		fmt.Printf("%s: %v\n", me, errGlobal)
 		fmt.Println()
-		fmt.Printf("example: %s list azure\n", me)
-		fmt.Printf("example: %s pull azure group1 resource-group-name > group1.yaml\n", me)
-		fmt.Printf("example: %s push azure group2 resource-group-name location < group1.yaml\n", me)
+		usage(me)
+		return 1
+	}
+
+	if len(args) < 2 {
+		fmt.Printf("%s: insufficient arguments\n", me)
 		fmt.Println()
-		fmt.Printf("example: %s list openstack\n", me)
-		fmt.Printf("example: %s pull openstack group1 > group1.yaml\n", me)
-		fmt.Printf("example: %s push openstack group2 < group1.yaml\n", me)
+		usage(me)
+		return 1
+	}
 
-		os.Exit(1)
+	if errLog := setupLogging(globalOpts); errLog != nil {
+		fmt.Printf("%s: %v\n", me, errLog)
+		return 1
 	}
 
-	debug = os.Getenv("DEBUG") != ""
-	log.Printf("DEBUG=[%s] debug=%v", os.Getenv("DEBUG"), debug)
+	retry.attempts = globalOpts.retries + 1
+
+	cancel := setupContext(globalOpts.timeout)
+	defer cancel()
 
-	cmd := os.Args[1]
-	cloud := os.Args[2]
-	args := os.Args[3:]
+	cmd := args[0]
 
-	switch {
-	case cloud == "aws":
-		if err := cloudAws(me, cmd, cloud, args); err != nil {
-			log.Printf("%s: %v", me, err)
-			os.Exit(3)
+	slog.SetDefault(slog.Default().With("operation", cmd))
+
+	var err error
+
+	switch cmd {
+	// commands not bound to a single cloud
+	case "query":
+		err = cmdQuery(me, args[1:])
+	case "clone":
+		err = cmdClone(me, args[1:])
+	case "copy":
+		err = cmdCopy(me, args[1:])
+	case "search":
+		err = cmdSearch(me, args[1:])
+	case "delete":
+		err = cmdDelete(me, args[1:])
+	case "usage":
+		err = cmdUsage(me, args[1:])
+	case "diff":
+		err = cmdDiff(me, args[1:])
+	case "lint":
+		err = cmdLint(me, args[1:])
+	case "migrate":
+		err = cmdMigrate(me, args[1:])
+	case "optimize":
+		err = cmdOptimize(me, args[1:])
+	case "sync":
+		err = cmdSync(me, args[1:])
+	case "rename":
+		err = cmdRename(me, args[1:])
+	case "render":
+		err = cmdRender(me, args[1:])
+	default:
+		cloud := args[1]
+		cloudArgs := args[2:]
+
+		switch cloud {
+		case "aws":
+			err = cloudAws(me, cmd, cloud, cloudArgs)
+		case "azure":
+			err = cloudAzure(me, cmd, cloud, cloudArgs)
+		case "openstack":
+			err = cloudOpenstack(me, cmd, cloud, cloudArgs)
+		default:
+			slog.Error("cloud not supported", "cloud", cloud)
+			return 2
 		}
-	case cloud == "azure":
-		if err := cloudAzure(me, cmd, cloud, args); err != nil {
-			log.Printf("%s: %v", me, err)
-			os.Exit(3)
+	}
+
+	if cmd == "diff" && err == errDiffer {
+		return 1
+	}
+	if err != nil {
+		slog.Error("command failed", "error", err)
+		return 3
+	}
+	return 0
+}
+
+// parseFlags parses flags interleaved with positional arguments,
+// returning the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
 		}
-	case cloud == "openstack":
-		if err := cloudOpenstack(me, cmd, cloud, args); err != nil {
-			log.Printf("%s: %v", me, err)
-			os.Exit(3)
+		args = fs.Args()
+		if len(args) < 1 {
+			return positional, nil
 		}
-	default:
-		log.Printf("%s: cloud not supported: %s", me, cloud)
-		os.Exit(2)
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
 }
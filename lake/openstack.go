@@ -1,14 +1,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	//"github.com/gophercloud/gophercloud/openstack/utils"
 )
 
@@ -16,21 +22,33 @@ func cloudOpenstack(me, cmd, cloud string, args []string) error {
 
 	switch cmd {
 	case "list":
-		return listOpenstack(me, cmd)
+		listOpts, _, errFlags := parseListFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		return listOpenstack(me, cmd, listOpts)
 	case "pull":
+		pullOpts, pullArgs, errFlags := parsePullFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		args = pullArgs
 		if len(args) < 1 {
-			log.Printf("usage: %s %s %s name", me, cmd, cloud)
-			return fmt.Errorf("%s %s %s: missing name", me, cmd, cloud)
+			return fmt.Errorf("missing name, usage: %s %s %s name", me, cmd, cloud)
 		}
 		name := args[0]
-		return pullOpenstack(me, cmd, name)
+		return pullOpenstack(me, cmd, name, pullOpts)
 	case "push":
+		pushOpts, pushArgs, errFlags := parsePushFlags(args)
+		if errFlags != nil {
+			return errFlags
+		}
+		args = pushArgs
 		if len(args) < 1 {
-			log.Printf("usage: %s %s %s name", me, cmd, cloud)
-			return fmt.Errorf("%s %s %s: missing name", me, cmd, cloud)
+			return fmt.Errorf("missing name, usage: %s %s %s name", me, cmd, cloud)
 		}
 		name := args[0]
-		return pushOpenstack(me, cmd, name)
+		return pushOpenstack(me, cmd, name, pushOpts)
 	}
 
 	return fmt.Errorf("unsupported %s command: %s", cloud, cmd)
@@ -38,118 +56,180 @@ func cloudOpenstack(me, cmd, cloud string, args []string) error {
 
 func showCredentialsOpenstack() {
 	cred("OS_REGION_NAME")
-	cred("OS_TENANT_ID")
+	credHide("OS_TENANT_ID")
 	cred("OS_IDENTITY_API_VERSION")
 	cred("OS_AUTH_URL")
-	cred("OS_TENANT_NAME")
+	credHide("OS_TENANT_NAME")
 	cred("OS_ENDPOINT_TYPE")
-	cred("OS_USERNAME")
+	credHide("OS_USERNAME")
 	credHide("OS_PASSWORD")
 }
 
-func listOpenstack(me, cmd string) error {
+func listOpenstack(me, cmd string, listOpts listOptions) error {
+	records, errList := listRecordsOpenstack(listOpts.usage)
+	if errList != nil {
+		return errList
+	}
+	return writeRecords(listOpts.format, records)
+}
+
+// listRecordsOpenstack lists groups in region.
+func listRecordsOpenstack(usage bool) ([]groupRecord, error) {
 
 	showCredentialsOpenstack()
 
 	regionName := os.Getenv("OS_REGION_NAME")
 	if regionName == "" {
-		return fmt.Errorf("missing env var OS_REGION_NAME")
+		return nil, fmt.Errorf("missing env var OS_REGION_NAME")
 	}
 
 	opts, errAuth := openstack.AuthOptionsFromEnv()
 	if errAuth != nil {
-		return errAuth
+		return nil, errAuth
 	}
 
-	provider, errProv := openstack.AuthenticatedClient(opts)
+	provider, errProv := authOpenstack(opts)
 	if errProv != nil {
-		return errProv
+		return nil, errProv
 	}
 
 	client, errClient := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{
 		Region: regionName,
 	})
 	if errClient != nil {
-		return errClient
+		return nil, errClient
 	}
 
 	allPages, errList := groups.List(client, groups.ListOpts{}).AllPages()
 	if errList != nil {
-		return errList
+		return nil, errList
 	}
 
 	allGroups, errExtract := groups.ExtractGroups(allPages)
 	if errExtract != nil {
-		return errExtract
+		return nil, errExtract
 	}
 
 	// https://godoc.org/github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups#SecGroup
 
+	var allPorts []ports.Port
+	var errPorts error
+	if usage {
+		allPorts, errPorts = listPortsOpenstack(client)
+	}
+
+	var records []groupRecord
+
 	for _, gr := range allGroups {
-		fmt.Printf("name=%s id=%s project=%s description=%s\n", gr.Name, gr.ID, gr.ProjectID, gr.Description)
+		rec := groupRecord{
+			Cloud:       "openstack",
+			Scope:       regionName,
+			Name:        gr.Name,
+			ID:          gr.ID,
+			Description: gr.Description,
+			Tags:        openstackTagsPull(gr.Tags),
+			Extra:       map[string]string{"projectId": gr.ProjectID},
+		}
+		for _, sgr := range gr.Rules {
+			if sgr.Direction == "ingress" {
+				rec.RulesIn++
+			} else {
+				rec.RulesOut++
+			}
+		}
+		if usage {
+			rec.setAttachments(attachmentsPorts(allPorts, gr.ID), errPorts)
+		}
+		records = append(records, rec)
 	}
 
+	return records, nil
+}
+
+func pullOpenstack(me, cmd, name string, pullOpts pullOptions) error {
+	gr, errFetch := fetchOpenstack(name)
+	if errFetch != nil {
+		return errFetch
+	}
+
+	pullOpts.output(gr)
+
 	return nil
 }
 
-func pullOpenstack(me, cmd, name string) error {
+func fetchOpenstack(name string) (*group, error) {
 
 	showCredentialsOpenstack()
 
 	regionName := os.Getenv("OS_REGION_NAME")
 	if regionName == "" {
-		return fmt.Errorf("missing env var OS_REGION_NAME")
+		return nil, fmt.Errorf("missing env var OS_REGION_NAME")
 	}
 
 	opts, errAuth := openstack.AuthOptionsFromEnv()
 	if errAuth != nil {
-		return errAuth
+		return nil, errAuth
 	}
 
-	provider, errProv := openstack.AuthenticatedClient(opts)
+	provider, errProv := authOpenstack(opts)
 	if errProv != nil {
-		return errProv
+		return nil, errProv
 	}
 
 	client, errClient := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{
 		Region: regionName,
 	})
 	if errClient != nil {
-		return errClient
+		return nil, errClient
 	}
 
 	groupID, errID := groups.IDFromName(client, name)
 	if errID != nil {
-		return errID
+		var notFound gophercloud.ErrResourceNotFound
+		if errors.As(errID, &notFound) {
+			return nil, fmt.Errorf("%w: %v", errGroupNotFound, errID)
+		}
+		return nil, errID
 	}
 
-	sg, errGet := groups.Get(client, groupID).Extract()
+	sg, extra, errGet := getGroupOpenstack(client, groupID)
 	if errGet != nil {
-		return errGet
+		return nil, errGet
 	}
 
-	gr := group{
+	gr := &group{
 		Description: sg.Description,
 	}
 
+	if extra.stateful != nil && !*extra.stateful {
+		gr.Openstack = &groupOpenstack{Stateful: extra.stateful}
+	}
+
 	for _, sgr := range sg.Rules {
 		var r rule
 
-		r.PortFirst = int64(sgr.PortRangeMin)
-		r.PortLast = int64(sgr.PortRangeMax)
-		r.Protocol = sgr.Protocol
+		r.Protocol = protoNormalize(sgr.Protocol)
+		if protoIcmp(r.Protocol) {
+			// port range carries ICMP type/code
+			r.IcmpType, r.IcmpCode = icmpPullOpenstack(extra.ports[sgr.ID].Min, extra.ports[sgr.ID].Max)
+		} else {
+			r.PortFirst = int64(sgr.PortRangeMin)
+			r.PortLast = int64(sgr.PortRangeMax)
+		}
 
-		if sgr.RemoteGroupID != "" {
-			log.Printf("unsupported: RemoteGroupID=[%s]", sgr.RemoteGroupID)
+		isPrefixV6 := sgr.EtherType == "IPv6"
 
-			if sgr.RemoteIPPrefix == "" {
-				continue // do not install default prefix by accident
+		if sgr.RemoteGroupID != "" {
+			slog.Info("group references another group", "cloud", "openstack", "group", name, "ref", sgr.RemoteGroupID)
+			r.Openstack = &ruleOpenstack{
+				RemoteGroupID: sgr.RemoteGroupID,
+				EtherType:     sgr.EtherType,
 			}
+		} else {
+			visitSrcPrefixV(&r, sgr.RemoteIPPrefix, "", isPrefixV6)
 		}
 
-		isPrefixV6 := sgr.EtherType == "IPv6"
-
-		visitSrcPrefixV(&r, sgr.RemoteIPPrefix, "", isPrefixV6)
+		r.Description = sgr.Description
 
 		if sgr.Direction == "ingress" {
 			gr.RulesIn = append(gr.RulesIn, r)
@@ -158,12 +238,12 @@ func pullOpenstack(me, cmd, name string) error {
 		}
 	}
 
-	gr.output()
+	gr.setTags(openstackTagsPull(sg.Tags))
 
-	return nil
+	return gr, nil
 }
 
-func pushOpenstack(me, cmd, name string) error {
+func pushOpenstack(me, cmd, name string, pushOpts pushOptions) error {
 
 	var gr group
 
@@ -171,6 +251,16 @@ func pushOpenstack(me, cmd, name string) error {
 		return errLoad
 	}
 
+	return applyOpenstack(me, &gr, name, pushOpts)
+}
+
+// applyOpenstack pushes loaded group.
+func applyOpenstack(me string, gr *group, name string, pushOpts pushOptions) error {
+
+	if errCheck := checkPush(me, "openstack", name, gr, pushOpts); errCheck != nil {
+		return errCheck
+	}
+
 	showCredentialsOpenstack()
 
 	regionName := os.Getenv("OS_REGION_NAME")
@@ -183,7 +273,7 @@ func pushOpenstack(me, cmd, name string) error {
 		return errAuth
 	}
 
-	provider, errProv := openstack.AuthenticatedClient(opts)
+	provider, errProv := authOpenstack(opts)
 	if errProv != nil {
 		return errProv
 	}
@@ -195,20 +285,41 @@ func pushOpenstack(me, cmd, name string) error {
 		return errClient
 	}
 
+	parts := pushParts(me, "openstack", name, gr, pushOpts)
+	for i, part := range parts {
+		if errStop := stopBetweenParts(name, i, len(parts)); errStop != nil {
+			return errStop
+		}
+		if errPush := pushGroupOpenstack(client, part.gr, me, part.name, pushOpts.workers); errPush != nil {
+			return errPush
+		}
+	}
+
+	warnSplitOriginal("openstack", name, parts, func() (*group, error) { return fetchOpenstack(name) })
+
+	return nil
+}
+
+func pushGroupOpenstack(client *gophercloud.ServiceClient, gr *group, me, name string, workers int) error {
 	groupID, errID := groups.IDFromName(client, name)
 	if errID != nil {
-		log.Printf("%s: group=%s not found: %v", me, name, errID)
-		return createOpenstack(client, &gr, me, name)
+		slog.Info("group not found", "cloud", "openstack", "group", name, "error", errID)
+		return createOpenstack(client, gr, me, name, workers)
 	}
 
-	return updateOpenstack(client, &gr, me, name, groupID)
+	return updateOpenstack(client, gr, me, name, groupID, workers)
 }
 
-func createOpenstack(client *gophercloud.ServiceClient, gr *group, me, name string) error {
-	log.Printf("%s: creating new group=%s", me, name)
+func createOpenstack(client *gophercloud.ServiceClient, gr *group, me, name string, workers int) error {
+	slog.Info("creating new group", "cloud", "openstack", "group", name)
 
-	createOpts := groups.CreateOpts{
-		Name: name,
+	createOpts := openstackGroupCreateOpts{
+		CreateOpts: groups.CreateOpts{
+			Name: name,
+		},
+	}
+	if gr.Openstack != nil {
+		createOpts.stateful = gr.Openstack.Stateful
 	}
 
 	sg, errCreate := groups.Create(client, createOpts).Extract()
@@ -216,90 +327,483 @@ func createOpenstack(client *gophercloud.ServiceClient, gr *group, me, name stri
 		return errCreate
 	}
 
-	log.Printf("%s: created group=%s group-id=%s", me, name, sg.ID)
+	slog.Info("created new group", "cloud", "openstack", "group", name, "group_id", sg.ID)
 
-	return updateOpenstack(client, gr, me, name, sg.ID)
+	if errStop := safePoint(); errStop != nil {
+		return fmt.Errorf("group=%s created with default rules only: %v", name, errStop)
+	}
+
+	return updateOpenstack(client, gr, me, name, sg.ID, workers)
 }
 
-func updateOpenstack(client *gophercloud.ServiceClient, gr *group, me, name, groupID string) error {
-	log.Printf("%s: updating existing group=%s group-id=%s", me, name, groupID)
+func updateOpenstack(client *gophercloud.ServiceClient, gr *group, me, name, groupID string, workers int) error {
+	slog.Info("updating existing group", "cloud", "openstack", "group", name, "group_id", groupID)
 
-	updateOpts := groups.UpdateOpts{
-		Description: &gr.Description,
+	if errStop := safePoint(); errStop != nil {
+		return fmt.Errorf("group=%s left unchanged: %v", name, errStop)
+	}
+
+	// replacing rules must not stop halfway, or group is left empty
+	ctx, cancel := criticalContext()
+	defer cancel()
+	client.Context = ctx
+	defer func() { client.Context = runCtx }()
+
+	updateOpts := openstackGroupUpdateOpts{
+		UpdateOpts: groups.UpdateOpts{
+			Description: &gr.Description,
+		},
+	}
+	if gr.Openstack != nil {
+		updateOpts.stateful = gr.Openstack.Stateful
 	}
 
 	if _, errUpdateDesc := groups.Update(client, groupID, updateOpts).Extract(); errUpdateDesc != nil {
 		return errUpdateDesc
 	}
 
-	log.Printf("%s: group=%s updated description=[%s]", me, name, gr.Description)
+	slog.Debug("updated description", "cloud", "openstack", "group", name, "description", gr.Description)
 
-	sg, errGet := groups.Get(client, groupID).Extract()
+	sg, extra, errGet := getGroupOpenstack(client, groupID)
 	if errGet != nil {
 		return errGet
 	}
 
-	log.Printf("%s: group=%s deleting %d rules...", me, name, len(sg.Rules))
+	if errReplace := replaceRulesOpenstack(client, gr, sg.Rules, name, groupID, workers); errReplace != nil {
+		slog.Error("replacing rules failed, restoring previous rules", "cloud", "openstack", "group", name, "group_id", groupID, "error", errReplace)
+		ctxRestore, cancelRestore := criticalContext()
+		defer cancelRestore()
+		client.Context = ctxRestore
+		if errRestore := restoreOpenstack(client, sg.Rules, extra.ports, name, groupID, workers); errRestore != nil {
+			return fmt.Errorf("group=%s left in unknown state, restore failed: %v (push again to recover): %v", name, errRestore, errReplace)
+		}
+		return fmt.Errorf("group=%s left with previous rules: %v", name, errReplace)
+	}
 
-	for _, sgr := range sg.Rules {
-		errDel := rules.Delete(client, sgr.ID).ExtractErr()
-		if errDel != nil {
-			return errDel
+	if gr.hasTags() {
+		tags, warnings := gr.tagsForCloud("openstack")
+		for _, w := range warnings {
+			slog.Warn(w, "cloud", "openstack", "group", name)
+		}
+		opts := attributestags.ReplaceAllOpts{Tags: openstackTagsPush(tags)}
+		if _, errTags := attributestags.ReplaceAll(client, "security-groups", groupID, opts).Extract(); errTags != nil {
+			return errTags
 		}
+		slog.Info("updated tags", "cloud", "openstack", "group", name, "count", len(tags))
+	}
+
+	if errStop := safePoint(); errStop != nil {
+		slog.Warn("finished updating group before stopping", "cloud", "openstack", "group", name, "error", errStop)
 	}
 
-	log.Printf("%s: group=%s deleting %d rules...done", me, name, len(sg.Rules))
+	return nil
+}
+
+// replaceRulesOpenstack deletes existing rules and creates rules from gr.
+func replaceRulesOpenstack(client *gophercloud.ServiceClient, gr *group, existing []rules.SecGroupRule, name, groupID string, workers int) error {
+	slog.Info("deleting existing rules", "cloud", "openstack", "group", name, "count", len(existing))
+
+	if _, errDel := deleteRulesOpenstack(client, existing, workers); errDel != nil {
+		return errDel
+	}
+
+	createList := append(ruleOptsOpenstack(gr.RulesIn, groupID, rules.DirIngress), ruleOptsOpenstack(gr.RulesOut, groupID, rules.DirEgress)...)
+
+	count, errCreate := createRulesOpenstack(client, createList, workers)
+
+	slog.Info("created rules", "cloud", "openstack", "group", name, "count", count, "expected", len(createList))
+
+	return errCreate
+}
 
-	log.Printf("%s: group=%s creating new rules...", me, name)
+// restoreOpenstack puts back rules of previous group state prev.
+func restoreOpenstack(client *gophercloud.ServiceClient, prev []rules.SecGroupRule, prevPorts map[string]portsOpenstack, name, groupID string, workers int) error {
+	sg, errGet := groups.Get(client, groupID).Extract()
+	if errGet != nil {
+		return errGet
+	}
 
-	countIn, errIn := scanRulesOpenstack(client, gr.RulesIn, groupID, rules.DirIngress)
-	if errIn != nil {
-		return errIn
+	if _, errDel := deleteRulesOpenstack(client, sg.Rules, workers); errDel != nil {
+		return errDel
+	}
+
+	var createList []openstackRuleOpts
+	for _, sgr := range prev {
+		createOpts := openstackRuleOpts{
+			CreateOpts: rules.CreateOpts{
+				Direction:      rules.RuleDirection(sgr.Direction),
+				Description:    sgr.Description,
+				PortRangeMin:   sgr.PortRangeMin,
+				PortRangeMax:   sgr.PortRangeMax,
+				EtherType:      rules.RuleEtherType(sgr.EtherType),
+				Protocol:       rules.RuleProtocol(sgr.Protocol),
+				SecGroupID:     groupID,
+				RemoteGroupID:  sgr.RemoteGroupID,
+				RemoteIPPrefix: sgr.RemoteIPPrefix,
+			},
+		}
+		if p := prevPorts[sgr.ID]; protoIcmp(sgr.Protocol) {
+			createOpts.icmpTypeZero = p.Min != nil && *p.Min == 0
+			createOpts.icmpCodeZero = p.Max != nil && *p.Max == 0
+		}
+		createList = append(createList, createOpts)
 	}
-	countOut, errOut := scanRulesOpenstack(client, gr.RulesOut, groupID, rules.DirEgress)
-	if errOut != nil {
-		return errOut
+
+	count, errCreate := createRulesOpenstack(client, createList, workers)
+	if errCreate != nil {
+		return errCreate
 	}
 
-	log.Printf("%s: group=%s creating new rules...done (%d rules)", me, name, countIn+countOut)
+	slog.Info("restored previous rules", "cloud", "openstack", "group", name, "count", count)
 
 	return nil
 }
 
-func scanRulesOpenstack(client *gophercloud.ServiceClient, ruleList []rule, groupID string, direction rules.RuleDirection) (int, error) {
-	var count int
+// ruleOptsOpenstack builds one create request per block and remote group.
+func ruleOptsOpenstack(ruleList []rule, groupID string, direction rules.RuleDirection) []openstackRuleOpts {
+	var list []openstackRuleOpts
 
 	for _, r := range ruleList {
-		for _, b := range r.Blocks {
-			createOpts := createRuleOpenstack(r, groupID, b.Address, rules.EtherType4, direction)
-			_, errCreate := rules.Create(client, createOpts).Extract()
-			if errCreate != nil {
-				return count, errCreate
+		if r.Openstack != nil && r.Openstack.RemoteGroupID != "" {
+			etherType := rules.EtherType4
+			if r.Openstack.EtherType == "IPv6" {
+				etherType = rules.EtherType6
 			}
-			count++
+			createOpts := createRuleOpenstack(r, groupID, block{}, etherType, direction)
+			createOpts.RemoteGroupID = r.Openstack.RemoteGroupID
+			list = append(list, createOpts)
+		}
+		for _, b := range r.Blocks {
+			list = append(list, createRuleOpenstack(r, groupID, b, rules.EtherType4, direction))
 		}
 		for _, b := range r.BlocksV6 {
-			createOpts := createRuleOpenstack(r, groupID, b.Address, rules.EtherType6, direction)
-			_, errCreate := rules.Create(client, createOpts).Extract()
-			if errCreate != nil {
-				return count, errCreate
-			}
-			count++
+			list = append(list, createRuleOpenstack(r, groupID, b, rules.EtherType6, direction))
 		}
 	}
 
-	return count, nil
+	return list
 }
 
-func createRuleOpenstack(r rule, groupID, prefix string, etherType rules.RuleEtherType, direction rules.RuleDirection) rules.CreateOpts {
-	createOpts := rules.CreateOpts{
-		Direction:      direction,
-		PortRangeMin:   int(r.PortFirst),
-		PortRangeMax:   int(r.PortLast),
-		EtherType:      etherType,
-		Protocol:       rules.RuleProtocol(r.Protocol),
-		SecGroupID:     groupID,
-		RemoteIPPrefix: prefix,
+// bulkSizeOpenstack limits rules sent in a single bulk create request.
+const bulkSizeOpenstack = 100
+
+// bulkUnsupportedOpenstack is set once endpoint refuses bulk create,
+// sparing further bulk attempts.
+var bulkUnsupportedOpenstack bool
+
+// createRulesOpenstack creates rules in bulk when endpoint supports it,
+// otherwise by up to workers concurrent requests.
+// Neutron creates bulk rules atomically, so a failed bulk is retried
+// rule by rule, reporting errors per rule.
+// Returns number of rules created.
+func createRulesOpenstack(client *gophercloud.ServiceClient, createList []openstackRuleOpts, workers int) (int, error) {
+	var count int
+	var single []openstackRuleOpts
+
+	for start := 0; start < len(createList); start += bulkSizeOpenstack {
+		end := start + bulkSizeOpenstack
+		if end > len(createList) {
+			end = len(createList)
+		}
+		chunk := createList[start:end]
+
+		if bulkUnsupportedOpenstack || len(chunk) < 2 {
+			single = append(single, chunk...)
+			continue
+		}
+
+		n, errBulk := bulkCreateOpenstack(client, chunk)
+		count += n
+		if errBulk == nil {
+			continue
+		}
+		if errCtx := client.Context.Err(); errCtx != nil {
+			return count, errBulk
+		}
+		if n > 0 {
+			return count, errBulk // partial bulk, not safe to create again
+		}
+		if bulkRefused(errBulk) {
+			bulkUnsupportedOpenstack = true
+			slog.Info("bulk rule create not supported, creating rules one by one", "cloud", "openstack", "error", errBulk)
+		} else {
+			slog.Warn("bulk rule create failed, creating rules one by one", "cloud", "openstack", "count", len(chunk), "error", errBulk)
+		}
+		single = append(single, chunk...)
+	}
+
+	n, errSingle := parallelOpenstack(len(single), workers, func(i int) error {
+		_, errCreate := rules.Create(client, single[i]).Extract()
+		return errCreate
+	})
+
+	return count + n, errSingle
+}
+
+// bulkCreateOpenstack creates rules with a single request.
+func bulkCreateOpenstack(client *gophercloud.ServiceClient, createList []openstackRuleOpts) (int, error) {
+	var list []interface{}
+	for _, createOpts := range createList {
+		b, errBody := createOpts.ToSecGroupRuleCreateMap()
+		if errBody != nil {
+			return 0, errBody
+		}
+		list = append(list, b["security_group_rule"])
+	}
+
+	body := map[string]interface{}{"security_group_rules": list}
+
+	var result struct {
+		Rules []rules.SecGroupRule `json:"security_group_rules"`
+	}
+
+	if _, errPost := client.Post(client.ServiceURL("security-group-rules"), body, &result, nil); errPost != nil {
+		return 0, errPost
+	}
+
+	if len(result.Rules) != len(createList) {
+		return len(result.Rules), fmt.Errorf("bulk rule create: created %d of %d rules", len(result.Rules), len(createList))
+	}
+
+	return len(result.Rules), nil
+}
+
+// bulkRefused reports whether error means endpoint does not support bulk create.
+func bulkRefused(err error) bool {
+	switch e := err.(type) {
+	case gophercloud.ErrDefault400:
+		return strings.Contains(strings.ToLower(string(e.Body)), "bulk")
+	case gophercloud.ErrDefault404, gophercloud.ErrDefault405:
+		return true
+	case gophercloud.ErrUnexpectedResponseCode:
+		return e.Actual == http.StatusNotImplemented
+	}
+	return false
+}
+
+// deleteRulesOpenstack deletes rules by up to workers concurrent requests.
+// Rules already gone are counted as deleted.
+func deleteRulesOpenstack(client *gophercloud.ServiceClient, ruleList []rules.SecGroupRule, workers int) (int, error) {
+	return parallelOpenstack(len(ruleList), workers, func(i int) error {
+		errDel := rules.Delete(client, ruleList[i].ID).ExtractErr()
+		if _, notFound := errDel.(gophercloud.ErrDefault404); notFound {
+			return nil
+		}
+		return errDel
+	})
+}
+
+// parallelOpenstack runs call for 0..n-1 by up to workers goroutines.
+// Returns number of successful calls and all errors.
+func parallelOpenstack(n, workers int, call func(i int) error) (int, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	errs := make([]error, n)
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = call(i)
+		}(i)
+	}
+
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return n - len(failed), fmt.Errorf("%d of %d request(s) failed: %w", len(failed), n, errors.Join(failed...))
+	}
+
+	return n, nil
+}
+
+func openstackProtoPush(p string) string {
+	proto, err := protoPush("openstack", p)
+	if err != nil {
+		slog.Warn("protocol not mapped", "cloud", "openstack", "error", err)
+		return p
+	}
+	return proto
+}
+
+// openstackRuleOpts is a rule create request able to send ICMP type or
+// code 0, which rules.CreateOpts omits as empty, meaning any.
+type openstackRuleOpts struct {
+	rules.CreateOpts
+	icmpTypeZero bool // send port_range_min 0
+	icmpCodeZero bool // send port_range_max 0
+}
+
+func (opts openstackRuleOpts) ToSecGroupRuleCreateMap() (map[string]interface{}, error) {
+	b, errBody := opts.CreateOpts.ToSecGroupRuleCreateMap()
+	if errBody != nil {
+		return nil, errBody
+	}
+	body := b["security_group_rule"].(map[string]interface{})
+	if opts.icmpTypeZero {
+		body["port_range_min"] = 0
+	}
+	if opts.icmpCodeZero {
+		body["port_range_max"] = 0
+	}
+	return b, nil
+}
+
+func createRuleOpenstack(r rule, groupID string, b block, etherType rules.RuleEtherType, direction rules.RuleDirection) openstackRuleOpts {
+	createOpts := openstackRuleOpts{
+		CreateOpts: rules.CreateOpts{
+			Direction:      direction,
+			Description:    limitDescription("createRuleOpenstack", b.blockDescription(r), descMaxOpenstack),
+			PortRangeMin:   int(r.PortFirst),
+			PortRangeMax:   int(r.PortLast),
+			EtherType:      etherType,
+			Protocol:       rules.RuleProtocol(openstackProtoPush(r.Protocol)),
+			SecGroupID:     groupID,
+			RemoteIPPrefix: b.Address,
+		},
+	}
+	if protoIcmp(r.Protocol) {
+		// port range carries ICMP type/code, null meaning any
+		createOpts.PortRangeMin, createOpts.PortRangeMax = 0, 0
+		if icmpType, icmpCode := icmpPush(r); icmpType >= 0 {
+			createOpts.PortRangeMin = int(icmpType)
+			createOpts.icmpTypeZero = icmpType == 0
+			if icmpCode >= 0 {
+				createOpts.PortRangeMax = int(icmpCode)
+				createOpts.icmpCodeZero = icmpCode == 0
+			}
+		}
 	}
 	return createOpts
 }
+
+// portsOpenstack holds rule port range as sent by neutron, nil for null.
+// gophercloud reports null as 0, losing ICMP type or code 0.
+type portsOpenstack struct {
+	Min *int `json:"port_range_min"`
+	Max *int `json:"port_range_max"`
+}
+
+// extraOpenstack holds group fields gophercloud does not decode.
+type extraOpenstack struct {
+	ports    map[string]portsOpenstack // exact port ranges by rule ID
+	stateful *bool                     // nil when neutron lacks stateful-security-group extension
+}
+
+// getGroupOpenstack gets group along with fields gophercloud does not decode.
+func getGroupOpenstack(client *gophercloud.ServiceClient, groupID string) (*groups.SecGroup, extraOpenstack, error) {
+	res := groups.Get(client, groupID)
+
+	sg, errGet := res.Extract()
+	if errGet != nil {
+		return nil, extraOpenstack{}, errGet
+	}
+
+	var raw struct {
+		Stateful *bool `json:"stateful"`
+		Rules    []struct {
+			ID string `json:"id"`
+			portsOpenstack
+		} `json:"security_group_rules"`
+	}
+	if errRaw := res.ExtractIntoStructPtr(&raw, "security_group"); errRaw != nil {
+		return nil, extraOpenstack{}, errRaw
+	}
+
+	extra := extraOpenstack{ports: map[string]portsOpenstack{}, stateful: raw.Stateful}
+	for _, r := range raw.Rules {
+		extra.ports[r.ID] = r.portsOpenstack
+	}
+
+	return sg, extra, nil
+}
+
+// openstackGroupCreateOpts is a group create request able to send stateful,
+// which groups.CreateOpts lacks.
+type openstackGroupCreateOpts struct {
+	groups.CreateOpts
+	stateful *bool
+}
+
+func (opts openstackGroupCreateOpts) ToSecGroupCreateMap() (map[string]interface{}, error) {
+	b, errBody := opts.CreateOpts.ToSecGroupCreateMap()
+	if errBody != nil {
+		return nil, errBody
+	}
+	if opts.stateful != nil {
+		b["security_group"].(map[string]interface{})["stateful"] = *opts.stateful
+	}
+	return b, nil
+}
+
+// openstackGroupUpdateOpts is a group update request able to send stateful,
+// which groups.UpdateOpts lacks.
+type openstackGroupUpdateOpts struct {
+	groups.UpdateOpts
+	stateful *bool
+}
+
+func (opts openstackGroupUpdateOpts) ToSecGroupUpdateMap() (map[string]interface{}, error) {
+	b, errBody := opts.UpdateOpts.ToSecGroupUpdateMap()
+	if errBody != nil {
+		return nil, errBody
+	}
+	if opts.stateful != nil {
+		b["security_group"].(map[string]interface{})["stateful"] = *opts.stateful
+	}
+	return b, nil
+}
+
+// authOpenstack authenticates provider bound to runCtx.
+func authOpenstack(opts gophercloud.AuthOptions) (*gophercloud.ProviderClient, error) {
+	provider, errNew := openstack.NewClient(opts.IdentityEndpoint)
+	if errNew != nil {
+		return nil, errNew
+	}
+
+	provider.Context = runCtx
+	retryOpenstack(provider)
+
+	if errAuth := openstack.Authenticate(provider, opts); errAuth != nil {
+		return nil, errAuth
+	}
+
+	return provider, nil
+}
+
+func clientOpenstack() (*gophercloud.ServiceClient, error) {
+	showCredentialsOpenstack()
+
+	regionName := os.Getenv("OS_REGION_NAME")
+	if regionName == "" {
+		return nil, fmt.Errorf("missing env var OS_REGION_NAME")
+	}
+
+	opts, errAuth := openstack.AuthOptionsFromEnv()
+	if errAuth != nil {
+		return nil, errAuth
+	}
+
+	provider, errProv := authOpenstack(opts)
+	if errProv != nil {
+		return nil, errProv
+	}
+
+	return openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{
+		Region: regionName,
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+)
+
+func TestStatefulOpenstack(t *testing.T) {
+	stateless := false
+	stateful := true
+
+	for _, data := range []struct {
+		name     string
+		stateful *bool
+		want     interface{} // nil means field absent
+	}{
+		{"unset", nil, nil},
+		{"stateless", &stateless, false},
+		{"stateful", &stateful, true},
+	} {
+		create, errCreate := openstackGroupCreateOpts{CreateOpts: groups.CreateOpts{Name: "g"}, stateful: data.stateful}.ToSecGroupCreateMap()
+		if errCreate != nil {
+			t.Fatalf("%s: %v", data.name, errCreate)
+		}
+		desc := ""
+		update, errUpdate := openstackGroupUpdateOpts{UpdateOpts: groups.UpdateOpts{Description: &desc}, stateful: data.stateful}.ToSecGroupUpdateMap()
+		if errUpdate != nil {
+			t.Fatalf("%s: %v", data.name, errUpdate)
+		}
+
+		for _, b := range []map[string]interface{}{create, update} {
+			got, found := b["security_group"].(map[string]interface{})["stateful"]
+			if data.want == nil && found {
+				t.Errorf("%s: stateful=%v, want absent", data.name, got)
+			}
+			if data.want != nil && got != data.want {
+				t.Errorf("%s: stateful=%v, want %v", data.name, got, data.want)
+			}
+		}
+	}
+}
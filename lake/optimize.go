@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+)
+
+// optimize merges adjacent blocks and removes blocks covered by other
+// blocks of the same rule, keeping the allowed address set unchanged.
+// Returns block counts before and after.
+func (g *group) optimize() (int, int) {
+	var before, after int
+	for _, list := range [][]rule{g.RulesIn, g.RulesOut} {
+		for i := range list {
+			r := &list[i]
+			before += len(r.Blocks) + len(r.BlocksV6)
+			r.Blocks = optimizeBlocks(r.Blocks)
+			r.BlocksV6 = optimizeBlocks(r.BlocksV6)
+			after += len(r.Blocks) + len(r.BlocksV6)
+		}
+	}
+	return before, after
+}
+
+type prefixBlock struct {
+	net  net.IPNet
+	ones int
+	desc []string
+}
+
+// optimizeBlocks aggregates CIDR blocks. Blocks which are not plain CIDRs
+// (service tags, blocks with provider extensions) are kept untouched.
+func optimizeBlocks(blocks []block) []block {
+	var opaque []block
+	var prefixes []prefixBlock
+
+	for _, b := range blocks {
+		if b.Aws != nil || b.Azure != nil {
+			opaque = append(opaque, b)
+			continue
+		}
+		n, errNet := blockNet(b.Address)
+		if errNet != nil {
+			opaque = append(opaque, b)
+			continue
+		}
+		ones, _ := n.Mask.Size()
+		p := prefixBlock{net: *n, ones: ones}
+		if b.Description != "" {
+			p.desc = []string{b.Description}
+		}
+		prefixes = append(prefixes, p)
+	}
+
+	if len(prefixes) < 2 {
+		return blocks
+	}
+
+	prefixes = removeCovered(prefixes)
+	prefixes = mergeSiblings(prefixes)
+
+	result := opaque
+	for _, p := range prefixes {
+		result = append(result, block{
+			Address:     prefixString(p.net),
+			Description: strings.Join(uniqueStrings(p.desc), "; "),
+		})
+	}
+
+	// keep original spelling of unchanged blocks
+	original := map[string]string{}
+	for _, b := range blocks {
+		if n, errNet := blockNet(b.Address); errNet == nil {
+			original[prefixString(*n)] = b.Address
+		}
+	}
+	for i := range result {
+		if a, found := original[result[i].Address]; found {
+			result[i].Address = a
+		}
+	}
+
+	return result
+}
+
+// prefixString formats prefix, keeping IPv4-mapped IPv6 prefixes apart from IPv4 ones.
+func prefixString(n net.IPNet) string {
+	ones, bits := n.Mask.Size()
+	if bits == 8*net.IPv6len && n.IP.To4() != nil {
+		return fmt.Sprintf("::ffff:%s/%d", n.IP.To4(), ones)
+	}
+	return n.String()
+}
+
+// sortPrefixes orders prefixes by family, address and length, so a prefix
+// is followed by the prefixes it covers.
+func sortPrefixes(prefixes []prefixBlock) {
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		_, bitsI := prefixes[i].net.Mask.Size()
+		_, bitsJ := prefixes[j].net.Mask.Size()
+		if bitsI != bitsJ {
+			return bitsI < bitsJ
+		}
+		if c := bytes.Compare(prefixes[i].net.IP, prefixes[j].net.IP); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].ones < prefixes[j].ones
+	})
+}
+
+// removeCovered drops prefixes contained in other prefixes.
+func removeCovered(prefixes []prefixBlock) []prefixBlock {
+	sortPrefixes(prefixes)
+	var result []prefixBlock
+	for _, p := range prefixes {
+		if len(result) > 0 {
+			last := &result[len(result)-1]
+			if netCovers(&last.net, &p.net) {
+				last.desc = append(last.desc, p.desc...)
+				continue
+			}
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// mergeSiblings replaces two halves of a prefix with the prefix itself, repeatedly.
+func mergeSiblings(prefixes []prefixBlock) []prefixBlock {
+	for {
+		sortPrefixes(prefixes)
+		var result []prefixBlock
+		var merged bool
+		for i := 0; i < len(prefixes); i++ {
+			p := prefixes[i]
+			if i+1 < len(prefixes) {
+				if parent, ok := siblingParent(p, prefixes[i+1]); ok {
+					parent.desc = append(append([]string{}, p.desc...), prefixes[i+1].desc...)
+					result = append(result, parent)
+					i++
+					merged = true
+					continue
+				}
+			}
+			result = append(result, p)
+		}
+		prefixes = removeCovered(result)
+		if !merged {
+			return prefixes
+		}
+	}
+}
+
+// siblingParent returns parent prefix when a and b are its lower and upper halves.
+func siblingParent(a, b prefixBlock) (prefixBlock, bool) {
+	if a.ones != b.ones || a.ones == 0 || len(a.net.IP) != len(b.net.IP) {
+		return prefixBlock{}, false
+	}
+	_, bits := a.net.Mask.Size()
+	parentMask := net.CIDRMask(a.ones-1, bits)
+	if !a.net.IP.Mask(parentMask).Equal(b.net.IP.Mask(parentMask)) || a.net.IP.Equal(b.net.IP) {
+		return prefixBlock{}, false
+	}
+	parent := prefixBlock{
+		net:  net.IPNet{IP: a.net.IP.Mask(parentMask), Mask: parentMask},
+		ones: a.ones - 1,
+	}
+	return parent, true
+}
+
+func uniqueStrings(list []string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, s := range list {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		result = append(result, s)
+	}
+	return result
+}
+
+func optimizeReport(caller, name string, before, after int) {
+	slog.Info("optimized blocks", "group", name, "before", before, "after", after, "saved", before-after)
+}
+
+func cmdOptimize(me string, args []string) error {
+	fs := flag.NewFlagSet("optimize", flag.ContinueOnError)
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	gr, errLoad := groupFromSource(me, positional)
+	if errLoad != nil {
+		return errLoad
+	}
+
+	before, after := gr.optimize()
+
+	gr.output()
+
+	optimizeReport(me, strings.Join(positional, " "), before, after)
+
+	return nil
+}
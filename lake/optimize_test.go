@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptimizeBlocks(t *testing.T) {
+	table := []struct {
+		name   string
+		blocks []block
+		want   []block
+	}{
+		{
+			name:   "adjacent",
+			blocks: []block{{Address: "10.0.0.0/25"}, {Address: "10.0.0.128/25"}},
+			want:   []block{{Address: "10.0.0.0/24"}},
+		},
+		{
+			name:   "adjacent repeatedly",
+			blocks: []block{{Address: "10.0.0.0/24"}, {Address: "10.0.2.0/23"}, {Address: "10.0.1.0/24"}},
+			want:   []block{{Address: "10.0.0.0/22"}},
+		},
+		{
+			name:   "adjacent not siblings",
+			blocks: []block{{Address: "10.0.1.0/24"}, {Address: "10.0.2.0/24"}},
+			want:   []block{{Address: "10.0.1.0/24"}, {Address: "10.0.2.0/24"}},
+		},
+		{
+			name:   "overlapping",
+			blocks: []block{{Address: "10.1.2.0/24", Description: "db"}, {Address: "10.0.0.0/8", Description: "corp"}},
+			want:   []block{{Address: "10.0.0.0/8", Description: "corp; db"}},
+		},
+		{
+			name:   "duplicate",
+			blocks: []block{{Address: "192.168.0.1"}, {Address: "192.168.0.1/32"}},
+			want:   []block{{Address: "192.168.0.1/32"}},
+		},
+		{
+			name:   "disjoint kept",
+			blocks: []block{{Address: "10.0.0.0/8"}, {Address: "192.168.0.0/16"}},
+			want:   []block{{Address: "10.0.0.0/8"}, {Address: "192.168.0.0/16"}},
+		},
+		{
+			name:   "v6 adjacent",
+			blocks: []block{{Address: "2001:db8::/33"}, {Address: "2001:db8:8000::/33"}},
+			want:   []block{{Address: "2001:db8::/32"}},
+		},
+		{
+			name: "mixed v4 v6",
+			blocks: []block{
+				{Address: "10.0.0.0/25"},
+				{Address: "2001:db8::/33"},
+				{Address: "10.0.0.128/25"},
+				{Address: "2001:db8:8000::/33"},
+				{Address: "::ffff:10.0.0.0/120"},
+			},
+			want: []block{{Address: "10.0.0.0/24"}, {Address: "::ffff:10.0.0.0/120"}, {Address: "2001:db8::/32"}},
+		},
+		{
+			name:   "v4-mapped v6 adjacent",
+			blocks: []block{{Address: "::ffff:10.0.0.0/121"}, {Address: "::ffff:10.0.0.128/121"}},
+			want:   []block{{Address: "::ffff:10.0.0.0/120"}},
+		},
+		{
+			name:   "v4 world does not cover v6",
+			blocks: []block{{Address: "0.0.0.0/0"}, {Address: "::/0"}, {Address: "10.0.0.0/8"}},
+			want:   []block{{Address: "0.0.0.0/0"}, {Address: "::/0"}},
+		},
+		{
+			name: "opaque kept",
+			blocks: []block{
+				{Address: "VirtualNetwork"},
+				{Address: "10.0.0.0/24", Aws: &blockAws{Description: "aws only"}},
+				{Address: "10.0.0.0/8"},
+			},
+			want: []block{
+				{Address: "VirtualNetwork"},
+				{Address: "10.0.0.0/24", Aws: &blockAws{Description: "aws only"}},
+				{Address: "10.0.0.0/8"},
+			},
+		},
+	}
+
+	for _, data := range table {
+		got := optimizeBlocks(data.blocks)
+		if !reflect.DeepEqual(got, data.want) {
+			t.Errorf("%s: got %v, want %v", data.name, got, data.want)
+		}
+	}
+}
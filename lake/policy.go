@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// orgPolicy holds guardrails enforced at push time.
+type orgPolicy struct {
+	ForbiddenBlocks     []string // CIDRs no block may overlap; 0.0.0.0/0 and ::/0 match only world-open blocks
+	ForbiddenPorts      []int64  // ports no allow rule may open
+	RequireDescriptions bool     // every block must be described, directly or by its rule
+	MaxRules            int      // cap on provider rules per group
+	AllowedGroups       []string // group name globs allowed for push, empty means any
+	OverrideLog         string   // file to append override records to
+}
+
+func loadOrgPolicy(path string) (*orgPolicy, error) {
+	buf, errRead := os.ReadFile(path)
+	if errRead != nil {
+		return nil, errRead
+	}
+
+	var policy orgPolicy
+	if errYaml := yaml.Unmarshal(buf, &policy); errYaml != nil {
+		return nil, fmt.Errorf("policy: %s: %v", path, errYaml)
+	}
+
+	for _, f := range policy.ForbiddenBlocks {
+		if _, errNet := blockNet(f); errNet != nil {
+			return nil, fmt.Errorf("policy: %s: bad forbidden block: %s", path, f)
+		}
+	}
+
+	return &policy, nil
+}
+
+// enforcePolicy refuses group violating org policy, unless overridden.
+func enforcePolicy(me, cloud, name string, gr *group, opts pushOptions) error {
+	if opts.policyFile == "" {
+		return nil
+	}
+
+	policy, errPolicy := loadOrgPolicy(opts.policyFile)
+	if errPolicy != nil {
+		return errPolicy
+	}
+
+	violations := policy.check(cloud, name, gr)
+	if len(violations) < 1 {
+		slog.Info("policy complies", "cloud", cloud, "group", name, "policy", opts.policyFile)
+		return nil
+	}
+
+	for _, v := range violations {
+		slog.Error("policy violation", "cloud", cloud, "group", name, "policy", opts.policyFile, "violation", v)
+	}
+
+	if opts.override == "" {
+		return fmt.Errorf("policy=%s: group=%s: %d violation(s), refusing to push (use --override reason)",
+			opts.policyFile, name, len(violations))
+	}
+
+	slog.Warn("POLICY OVERRIDE", "cloud", cloud, "group", name, "violations", len(violations), "reason", opts.override)
+
+	if policy.OverrideLog != "" {
+		if errLog := appendOverrideLog(policy.OverrideLog, cloud, name, opts.override, violations); errLog != nil {
+			return fmt.Errorf("policy override log: %v", errLog)
+		}
+	}
+
+	return nil
+}
+
+func appendOverrideLog(logPath, cloud, name, reason string, violations []string) error {
+	f, errOpen := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if errOpen != nil {
+		return errOpen
+	}
+
+	line := fmt.Sprintf("%s cloud=%s group=%s user=%s reason=%q violations=%q\n",
+		time.Now().UTC().Format(time.RFC3339), cloud, name, os.Getenv("USER"), reason, strings.Join(violations, "; "))
+
+	if _, errWrite := f.WriteString(line); errWrite != nil {
+		f.Close()
+		return errWrite
+	}
+
+	return f.Close()
+}
+
+// check lists policy violations.
+func (p *orgPolicy) check(cloud, name string, gr *group) []string {
+	var violations []string
+
+	if len(p.AllowedGroups) > 0 {
+		var allowed bool
+		for _, glob := range p.AllowedGroups {
+			if match, _ := path.Match(glob, name); match {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violations = append(violations, fmt.Sprintf("group name %s not allowed", name))
+		}
+	}
+
+	if p.MaxRules > 0 {
+		if count := providerRuleCount(cloud, gr); count > p.MaxRules {
+			violations = append(violations, fmt.Sprintf("%d %s rules exceed max %d", count, cloud, p.MaxRules))
+		}
+	}
+
+	gr.eachRule(func(dir string, i int, r *rule) {
+		violations = append(violations, p.checkRule(ruleLoc(dir, i), *r)...)
+	})
+
+	return violations
+}
+
+func (p *orgPolicy) checkRule(loc string, r rule) []string {
+	var violations []string
+
+	blocks := append(append([]block{}, r.Blocks...), r.BlocksV6...)
+
+	if !r.deny() {
+		for _, b := range blocks {
+			for _, f := range p.ForbiddenBlocks {
+				if blockOverlapsForbidden(b.Address, f) {
+					violations = append(violations, fmt.Sprintf("%s: block %s overlaps forbidden %s", loc, b.Address, f))
+				}
+			}
+		}
+		for _, port := range p.ForbiddenPorts {
+			if r.matchProtoPort("tcp", port) || r.matchProtoPort("udp", port) {
+				violations = append(violations, fmt.Sprintf("%s: forbidden port %d", loc, port))
+			}
+		}
+	}
+
+	if p.RequireDescriptions {
+		for _, b := range blocks {
+			if b.blockDescription(r) == "" {
+				violations = append(violations, fmt.Sprintf("%s: missing description for block %s", loc, b.Address))
+			}
+		}
+	}
+
+	return violations
+}
+
+func blockOverlapsForbidden(address, forbidden string) bool {
+	if blockIsWorld(forbidden) {
+		return blockIsWorld(address) && sameFamily(address, forbidden)
+	}
+	return blockCovers(address, forbidden) || blockCovers(forbidden, address)
+}
+
+func sameFamily(a, b string) bool {
+	if a == "*" || b == "*" {
+		return true
+	}
+	na, errA := blockNet(a)
+	nb, errB := blockNet(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	_, bitsA := na.Mask.Size()
+	_, bitsB := nb.Mask.Size()
+	return bitsA == bitsB
+}
+
+// providerRuleCount estimates how many rules the provider creates for group.
+func providerRuleCount(cloud string, gr *group) int {
+	u := providerUsage(cloud, gr)
+	return u.rulesIn + u.rulesOut
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// protoNames maps IANA protocol names to numbers.
+var protoNames = map[string]int{
+	"icmp":   1,
+	"igmp":   2,
+	"tcp":    6,
+	"udp":    17,
+	"gre":    47,
+	"esp":    50,
+	"ah":     51,
+	"icmpv6": 58,
+	"sctp":   132,
+}
+
+// protoAliases maps alternative spellings to canonical names.
+var protoAliases = map[string]string{
+	"ipv6-icmp": "icmpv6",
+	"icmp6":     "icmpv6",
+	"*":         "",
+	"-1":        "",
+	"all":       "",
+	"any":       "",
+}
+
+// protoNormalize maps protocol name or number, in any case, to canonical form:
+// lowercase IANA name when known, decimal number otherwise, empty string for all protocols.
+func protoNormalize(p string) string {
+	p = strings.ToLower(strings.TrimSpace(p))
+	if alias, found := protoAliases[p]; found {
+		return alias
+	}
+	if _, found := protoNames[p]; found {
+		return p
+	}
+	if n, errConv := strconv.Atoi(p); errConv == nil {
+		for name, number := range protoNames {
+			if number == n {
+				return name
+			}
+		}
+		return strconv.Itoa(n)
+	}
+	return p
+}
+
+// protoNumber returns IANA number for protocol.
+func protoNumber(p string) (int, bool) {
+	p = protoNormalize(p)
+	if n, found := protoNames[p]; found {
+		return n, true
+	}
+	n, errConv := strconv.Atoi(p)
+	return n, errConv == nil
+}
+
+func protoEqual(a, b string) bool {
+	return protoNormalize(a) == protoNormalize(b)
+}
+
+// protoAny reports whether protocol means all protocols.
+func protoAny(p string) bool {
+	return protoNormalize(p) == ""
+}
+
+func protoIcmp(p string) bool {
+	switch protoNormalize(p) {
+	case "icmp", "icmpv6":
+		return true
+	}
+	return false
+}
+
+// protoPorts reports whether protocol carries ports.
+func protoPorts(p string) bool {
+	switch protoNormalize(p) {
+	case "tcp", "udp", "sctp":
+		return true
+	}
+	return false
+}
+
+// protoPush maps protocol to the form expected by cloud.
+func protoPush(cloud, p string) (string, error) {
+	canonical := protoNormalize(p)
+
+	switch cloud {
+	case "aws":
+		// AWS takes names for tcp/udp/icmp/icmpv6, numbers otherwise
+		switch canonical {
+		case "":
+			return "-1", nil
+		case "tcp", "udp", "icmp", "icmpv6":
+			return canonical, nil
+		}
+	case "azure":
+		switch canonical {
+		case "":
+			return "*", nil
+		case "tcp", "udp", "icmp", "esp", "ah":
+			return strings.ToUpper(canonical[:1]) + canonical[1:], nil
+		}
+		return "", fmt.Errorf("azure does not support protocol=%s", p)
+	case "openstack":
+		switch canonical {
+		case "":
+			return "", nil
+		case "icmpv6":
+			return "ipv6-icmp", nil
+		}
+		if _, found := protoNames[canonical]; found {
+			return canonical, nil
+		}
+	}
+
+	n, found := protoNumber(canonical)
+	if !found || n < 0 || n > 255 {
+		return "", fmt.Errorf("%s: bad protocol=%s", cloud, p)
+	}
+
+	return strconv.Itoa(n), nil
+}
+
+// protoErrors reports protocols cloud cannot express.
+func protoErrors(cloud string, gr *group) []string {
+	var errors []string
+
+	gr.eachRule(func(dir string, i int, r *rule) {
+		if _, errProto := protoPush(cloud, r.Protocol); errProto != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", ruleLoc(dir, i), errProto))
+		}
+	})
+
+	return errors
+}
+
+func checkProto(me, cloud, name string, gr *group) error {
+	errors := protoErrors(cloud, gr)
+	for _, e := range errors {
+		slog.Error("unsupported protocol", "cloud", cloud, "group", name, "error", e)
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("group=%s: %d rule(s) with protocol unsupported by %s", name, len(errors), cloud)
+	}
+	return nil
+}
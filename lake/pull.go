@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+)
+
+// pullOptions holds flags shared by pull commands.
+type pullOptions struct {
+	services bool // collapse rules into service aliases
+}
+
+func parsePullFlags(args []string) (pullOptions, []string, error) {
+	var opts pullOptions
+
+	fs := flag.NewFlagSet("pull", flag.ContinueOnError)
+	fs.BoolVar(&opts.services, "services", false, "collapse rules into service aliases and port lists")
+
+	positional, errFlags := parseFlags(fs, args)
+
+	return opts, positional, errFlags
+}
+
+// output writes pulled group to stdout.
+func (opts pullOptions) output(gr *group) {
+	if opts.services {
+		gr.collapseServices()
+	}
+	gr.output()
+}
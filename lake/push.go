@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// pushOptions holds flags shared by push commands.
+type pushOptions struct {
+	policyFile string // org policy enforced before push
+	override   string // reason for pushing despite policy violations
+	optimize   bool   // aggregate blocks before push
+	split      bool   // split group exceeding provider quota into numbered groups
+	workers    int    // concurrent OpenStack rule requests
+}
+
+func parsePushFlags(args []string) (pushOptions, []string, error) {
+	var opts pushOptions
+
+	fs := flag.NewFlagSet("push", flag.ContinueOnError)
+	opts.register(fs)
+
+	positional, errFlags := parseFlags(fs, args)
+
+	return opts, positional, errFlags
+}
+
+// register defines push flags on fs, for commands which push as well.
+func (opts *pushOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&opts.policyFile, "policy", os.Getenv("LAKE_POLICY"), "org policy file (env var LAKE_POLICY)")
+	fs.StringVar(&opts.override, "override", "", "push despite policy violations, giving the reason")
+	fs.BoolVar(&opts.optimize, "optimize", false, "merge adjacent and remove redundant blocks before push")
+	fs.BoolVar(&opts.split, "split", false, "split group exceeding provider quota into groups name-1, name-2...")
+	fs.IntVar(&opts.workers, "workers", 8, "concurrent OpenStack rule requests")
+}
+
+// checkPush runs pre-push checks on loaded group.
+func checkPush(me, cloud, name string, gr *group, opts pushOptions) error {
+	if opts.optimize {
+		before, after := gr.optimize()
+		optimizeReport(me, name, before, after)
+	}
+
+	if errProto := checkProto(me, cloud, name, gr); errProto != nil {
+		return errProto
+	}
+
+	if errExt := checkExtensions(me, cloud, name, gr); errExt != nil {
+		return errExt
+	}
+
+	logIcmpWarnings(me, cloud, name, gr)
+
+	if cloud != "openstack" && gr.stateless() {
+		slog.Warn("stateless group not supported, rules are stateful", "cloud", cloud, "group", name)
+	}
+
+	if errPolicy := enforcePolicy(me, cloud, name, gr, opts); errPolicy != nil {
+		return errPolicy
+	}
+
+	return checkQuota(me, cloud, name, gr, opts)
+}
+
+// applyGroup pushes loaded group to live group ref.
+func applyGroup(me string, ref groupRef, gr *group, opts pushOptions) error {
+	ref.setRegion()
+	switch ref.cloud {
+	case "aws":
+		return applyAws(me, gr, ref.name, ref.scope, opts)
+	case "azure":
+		return applyAzure(me, gr, ref.name, ref.scope, ref.location, opts)
+	case "openstack":
+		return applyOpenstack(me, gr, ref.name, opts)
+	}
+	return fmt.Errorf("cloud not supported: %s", ref.cloud)
+}
+
+// checkRef checks ref holds the scope required to push.
+func checkRef(ref groupRef) error {
+	if ref.name == "" {
+		return fmt.Errorf("%s: missing group name", ref)
+	}
+	switch ref.cloud {
+	case "aws":
+		if ref.scope == "" {
+			return fmt.Errorf("%s: missing vpc-id: aws:name@vpc-id", ref)
+		}
+	case "azure":
+		if ref.scope == "" || ref.location == "" {
+			return fmt.Errorf("%s: missing resource group or location: azure:name@resource-group/location", ref)
+		}
+	}
+	return nil
+}
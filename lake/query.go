@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+)
+
+type query struct {
+	direction string // in|out
+	address   net.IP // remote address: source for in, destination for out
+	proto     string
+	port      int64
+	azureDst  net.IP // matched against azure destination prefixes, nil when unknown
+	srcPort   int64  // matched against azure source port ranges, 0 when unknown
+}
+
+type queryMatch struct {
+	index       int // rule index within RulesIn/RulesOut
+	r           rule
+	b           block
+	decisive    bool
+	conditional bool // rule azure destination or source port not checked by query
+}
+
+// Query verdicts.
+const (
+	verdictAllow         = "allow"
+	verdictDeny          = "deny"
+	verdictIndeterminate = "indeterminate"
+)
+
+func cmdQuery(me string, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	src := fs.String("src", "", "source address (direction in)")
+	dst := fs.String("dst", "", "destination address (direction out)")
+	port := fs.Int64("port", 0, "destination port, required for tcp, udp and sctp")
+	proto := fs.String("proto", "tcp", "protocol")
+	direction := fs.String("direction", "in", "traffic direction: in|out")
+	azureDst := fs.String("azure-dst", "", "address matched against azure destination prefixes")
+	srcPort := fs.Int64("src-port", 0, "source port matched against azure source port ranges")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	var address string
+	switch *direction {
+	case "in":
+		address = *src
+	case "out":
+		address = *dst
+	default:
+		return fmt.Errorf("query: bad direction: %s", *direction)
+	}
+	if address == "" {
+		if *direction == "in" {
+			return fmt.Errorf("query: missing --src address")
+		}
+		return fmt.Errorf("query: missing --dst address")
+	}
+
+	addr := net.ParseIP(address)
+	if addr == nil {
+		return fmt.Errorf("query: bad address: %s", address)
+	}
+
+	if protoPorts(*proto) && (*port < 1 || *port > 65535) {
+		if *port == 0 {
+			return fmt.Errorf("query: missing --port for protocol=%s", *proto)
+		}
+		return fmt.Errorf("query: bad port: %d", *port)
+	}
+
+	if *srcPort < 0 || *srcPort > 65535 {
+		return fmt.Errorf("query: bad source port: %d", *srcPort)
+	}
+
+	var dstAddr net.IP
+	if *azureDst != "" {
+		dstAddr = net.ParseIP(*azureDst)
+		if dstAddr == nil {
+			return fmt.Errorf("query: bad azure destination address: %s", *azureDst)
+		}
+	}
+
+	gr, errLoad := groupFromSource(me, positional)
+	if errLoad != nil {
+		return errLoad
+	}
+
+	q := query{
+		direction: *direction,
+		address:   addr,
+		proto:     *proto,
+		port:      *port,
+		azureDst:  dstAddr,
+		srcPort:   *srcPort,
+	}
+
+	matches, verdict := gr.query(q)
+
+	fmt.Printf("query: direction=%s address=%s protocol=%s port=%d\n", q.direction, q.address, q.proto, q.port)
+
+	for _, m := range matches {
+		var decisive string
+		if m.decisive {
+			decisive = " decisive"
+		}
+		if m.conditional {
+			decisive = " conditional (see --azure-dst, --src-port)"
+		}
+		fmt.Printf("match: rule=%d %s block=%s%s\n", m.index, m.r.describe(), m.b.Address, decisive)
+	}
+
+	if len(matches) < 1 {
+		fmt.Println("match: none (default deny)")
+	}
+
+	fmt.Printf("verdict: %s\n", verdict)
+
+	return nil
+}
+
+// describe formats rule fields relevant to traffic evaluation.
+func (r rule) describe() string {
+	proto := r.Protocol
+	if protoAny(proto) {
+		proto = "all"
+	}
+	access := "allow"
+	if r.deny() {
+		access = "deny"
+	}
+	s := fmt.Sprintf("protocol=%s ports=%d-%d access=%s", proto, r.PortFirst, r.PortLast, access)
+	if protoIcmp(r.Protocol) {
+		s = fmt.Sprintf("protocol=%s icmp-type=%s icmp-code=%s access=%s", proto, icmpString(r.IcmpType), icmpString(r.IcmpCode), access)
+	}
+	if r.Azure != nil {
+		s += fmt.Sprintf(" azure-priority=%d azure-name=%s", r.Azure.Priority, r.Azure.Name)
+	}
+	return s
+}
+
+// query evaluates traffic against group rules.
+// Rules carrying Azure priority/deny are evaluated in priority order
+// and the first match decides. Otherwise rules are allow-only and any
+// match allows. No match means deny.
+// Verdict is indeterminate when a rule with azure destination or source
+// port unknown to query could change the result.
+func (g *group) query(q query) ([]queryMatch, string) {
+	ruleList := g.RulesIn
+	if q.direction == "out" {
+		ruleList = g.RulesOut
+	}
+
+	ordered := isOrdered(ruleList)
+
+	indices := make([]int, len(ruleList))
+	for i := range indices {
+		indices[i] = i
+	}
+	if ordered {
+		sort.SliceStable(indices, func(i, j int) bool {
+			return ruleList[indices[i]].azure().Priority < ruleList[indices[j]].azure().Priority
+		})
+	}
+
+	var matches []queryMatch
+	var allow, decided bool
+	pending := map[bool]bool{} // access of conditional matches before decision
+
+	for _, i := range indices {
+		r := ruleList[i]
+		if !r.matchProtoPort(q.proto, q.port) {
+			continue
+		}
+		b, found := r.matchAddress(q.address)
+		if !found {
+			continue
+		}
+		conditional, filtered := r.matchAzureFilters(q)
+		if !filtered {
+			continue
+		}
+		m := queryMatch{index: i, r: r, b: b, conditional: conditional}
+		switch {
+		case decided:
+		case conditional:
+			pending[!r.deny()] = true
+		default:
+			// unordered rules are all allow, so first match decides as well
+			decided = true
+			m.decisive = true
+			allow = !r.deny()
+		}
+		matches = append(matches, m)
+	}
+
+	if pending[!allow] {
+		return matches, verdictIndeterminate
+	}
+	if allow {
+		return matches, verdictAllow
+	}
+	return matches, verdictDeny
+}
+
+// matchAzureFilters matches azure destination prefixes and source ports.
+// It reports rule as conditional when query lacks the values to match,
+// and filtered false when rule does not apply.
+func (r rule) matchAzureFilters(q query) (conditional, filtered bool) {
+	if dst := r.azureDestinations(); dst != nil {
+		if q.azureDst == nil {
+			conditional = true
+		} else {
+			var found, unknown bool
+			for _, d := range dst {
+				if blockContains(d, q.azureDst) {
+					found = true
+					break
+				}
+				if _, errNet := blockNet(d); errNet != nil {
+					unknown = true // service tag
+				}
+			}
+			switch {
+			case found:
+			case unknown:
+				conditional = true
+			default:
+				return false, false
+			}
+		}
+	}
+	if ports := r.azureSourcePorts(); ports != nil {
+		if q.srcPort == 0 {
+			conditional = true
+		} else if !portRangeListCovers(ports, strconv.FormatInt(q.srcPort, 10)) {
+			return false, false
+		}
+	}
+	return conditional, true
+}
+
+// isOrdered reports whether rules carry Azure priority/deny semantics.
+func isOrdered(ruleList []rule) bool {
+	for _, r := range ruleList {
+		if r.Azure != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// portsAny reports whether rule port range means all ports.
+// AWS "-1" protocol and OpenStack rules without range come as 0-0.
+func (r rule) portsAny() bool {
+	return r.PortFirst <= 0 && r.PortLast <= 0
+}
+
+func (r rule) matchProtoPort(proto string, port int64) bool {
+	if !protoAny(r.Protocol) && !protoEqual(r.Protocol, proto) {
+		return false
+	}
+	if protoIcmp(proto) || r.portsAny() {
+		return true // ICMP ports carry type/code, not ports
+	}
+	return r.PortFirst <= port && port <= r.PortLast
+}
+
+// matchAddress finds first rule block containing address.
+func (r rule) matchAddress(addr net.IP) (block, bool) {
+	for _, list := range [][]block{r.Blocks, r.BlocksV6} {
+		for _, b := range list {
+			if blockContains(b.Address, addr) {
+				return b, true
+			}
+		}
+	}
+	return block{}, false
+}
+
+// blockNet parses block address as CIDR.
+// A plain address is taken as host prefix.
+func blockNet(address string) (*net.IPNet, error) {
+	_, n, errCidr := net.ParseCIDR(address)
+	if errCidr == nil {
+		return n, nil
+	}
+	addr := net.ParseIP(address)
+	if addr == nil {
+		return nil, errCidr
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: addr, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+func blockContains(address string, addr net.IP) bool {
+	if address == "*" {
+		return true
+	}
+	n, errNet := blockNet(address)
+	if errNet != nil {
+		slog.Warn("unsupported block address", "address", address, "error", errNet)
+		return false
+	}
+	return n.Contains(addr)
+}
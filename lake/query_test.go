@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestQueryAzureFilters(t *testing.T) {
+	allowWeb := rule{
+		Protocol: "tcp", PortFirst: 443, PortLast: 443,
+		Blocks: []block{{Address: "0.0.0.0/0"}},
+		Azure:  &ruleAzure{Name: "web", Priority: 100, DestinationAddressPrefix: "10.1.0.0/16"},
+	}
+	denyAll := rule{
+		Protocol: "tcp", PortFirst: 0, PortLast: 65535,
+		Blocks: []block{{Address: "0.0.0.0/0"}},
+		Azure:  &ruleAzure{Name: "deny", Priority: 200, Deny: true},
+	}
+	allowSrcPorts := rule{
+		Protocol: "tcp", PortFirst: 443, PortLast: 443,
+		Blocks: []block{{Address: "0.0.0.0/0"}},
+		Azure:  &ruleAzure{Name: "ephemeral", Priority: 100, SourcePortRanges: []string{"1024-65535"}},
+	}
+	allowTag := rule{
+		Protocol: "tcp", PortFirst: 443, PortLast: 443,
+		Blocks: []block{{Address: "0.0.0.0/0"}},
+		Azure:  &ruleAzure{Name: "vnet", Priority: 100, DestinationAddressPrefix: "VirtualNetwork"},
+	}
+
+	allowWebLow := allowWeb
+	allowWebLow.Azure = &ruleAzure{Name: "web", Priority: 300, DestinationAddressPrefix: "10.1.0.0/16"}
+	allowAll := rule{
+		Protocol: "tcp", PortFirst: 443, PortLast: 443,
+		Blocks: []block{{Address: "0.0.0.0/0"}},
+		Azure:  &ruleAzure{Name: "all", Priority: 150},
+	}
+
+	table := []struct {
+		name     string
+		rules    []rule
+		azureDst string
+		srcPort  int64
+		want     string
+	}{
+		{"destination matches", []rule{allowWeb, denyAll}, "10.1.2.3", 0, verdictAllow},
+		{"other destination", []rule{allowWeb, denyAll}, "10.2.2.3", 0, verdictDeny},
+		{"destination unknown", []rule{allowWeb, denyAll}, "", 0, verdictIndeterminate},
+		{"destination unknown, no other rule", []rule{allowWeb}, "", 0, verdictIndeterminate},
+		{"source port matches", []rule{allowSrcPorts, denyAll}, "", 2000, verdictAllow},
+		{"other source port", []rule{allowSrcPorts, denyAll}, "", 80, verdictDeny},
+		{"source port unknown", []rule{allowSrcPorts, denyAll}, "", 0, verdictIndeterminate},
+		{"service tag destination", []rule{allowTag, denyAll}, "10.1.2.3", 0, verdictIndeterminate},
+		{"conditional after decision", []rule{denyAll, allowWebLow}, "", 0, verdictDeny},
+		{"conditional allow before allow", []rule{allowWeb, allowAll}, "", 0, verdictAllow},
+	}
+
+	for _, data := range table {
+		q := query{direction: "in", address: net.ParseIP("203.0.113.1"), proto: "tcp", port: 443, srcPort: data.srcPort}
+		if data.azureDst != "" {
+			q.azureDst = net.ParseIP(data.azureDst)
+		}
+		gr := group{RulesIn: data.rules}
+		if _, got := gr.query(q); got != data.want {
+			t.Errorf("%s: verdict=%s, want %s", data.name, got, data.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// quota holds provider limits for a single group. Zero means no limit.
+type quota struct {
+	rulesIn  int // ingress rules
+	rulesOut int // egress rules
+	rules    int // rules in both directions
+	prefixes int // remote address prefixes in all rules
+}
+
+// quotaTable holds provider default limits.
+// OpenStack rule quota is per project, the default is used as group limit.
+var quotaTable = map[string]quota{
+	"aws":       {rulesIn: 60, rulesOut: 60},
+	"azure":     {rules: 1000, prefixes: 4000},
+	"openstack": {rules: 100},
+}
+
+// quotaEnv overrides default rule limits, for raised provider quotas.
+var quotaEnv = map[string]string{
+	"aws":       "LAKE_AWS_RULES",       // per direction
+	"azure":     "LAKE_AZURE_RULES",     // per group
+	"openstack": "LAKE_OPENSTACK_RULES", // per group
+}
+
+func quotaFor(cloud string) quota {
+	q := quotaTable[cloud]
+	env := quotaEnv[cloud]
+	value := os.Getenv(env)
+	if value == "" {
+		return q
+	}
+	n, errConv := strconv.Atoi(value)
+	if errConv != nil || n < 1 {
+		slog.Warn("ignoring bad quota", "cloud", cloud, "env", env, "value", value)
+		return q
+	}
+	if cloud == "aws" {
+		q.rulesIn, q.rulesOut = n, n
+	} else {
+		q.rules = n
+	}
+	return q
+}
+
+// quotaUsage holds provider entries a group creates.
+type quotaUsage struct {
+	rulesIn  int
+	rulesOut int
+	prefixes int
+}
+
+// providerUsage pre-computes provider entries for group, as push creates them.
+func providerUsage(cloud string, gr *group) quotaUsage {
+	var u quotaUsage
+	u.rulesIn = providerRules(cloud, gr.RulesIn)
+	u.rulesOut = providerRules(cloud, gr.RulesOut)
+	if cloud == "azure" {
+		for _, list := range [][]rule{gr.RulesIn, gr.RulesOut} {
+			for _, set := range azureRuleSets(list) {
+				u.prefixes += len(srcAddressesAzure(set[0]))
+			}
+		}
+	}
+	return u
+}
+
+// providerRules counts provider rules for one direction.
+// AWS counts every CIDR and group reference after collapsing rules into permissions.
+// Azure creates one security rule per rule, rules differing only in ports share one.
+// OpenStack creates one rule per block and per remote group.
+func providerRules(cloud string, ruleList []rule) int {
+	switch cloud {
+	case "aws":
+		_, count := permFromRules(ruleList)
+		return count
+	case "azure":
+		return len(azureRuleSets(ruleList))
+	}
+	var count int
+	for _, r := range ruleList {
+		count += len(r.Blocks) + len(r.BlocksV6)
+		if r.Openstack != nil && r.Openstack.RemoteGroupID != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// quotaErrors lists provider limits exceeded by group.
+func quotaErrors(cloud string, gr *group, q quota) []string {
+	u := providerUsage(cloud, gr)
+
+	var errs []string
+	if q.rulesIn > 0 && u.rulesIn > q.rulesIn {
+		errs = append(errs, fmt.Sprintf("%d ingress rules exceed %s limit %d", u.rulesIn, cloud, q.rulesIn))
+	}
+	if q.rulesOut > 0 && u.rulesOut > q.rulesOut {
+		errs = append(errs, fmt.Sprintf("%d egress rules exceed %s limit %d", u.rulesOut, cloud, q.rulesOut))
+	}
+	if q.rules > 0 && u.rulesIn+u.rulesOut > q.rules {
+		errs = append(errs, fmt.Sprintf("%d rules exceed %s limit %d", u.rulesIn+u.rulesOut, cloud, q.rules))
+	}
+	if q.prefixes > 0 && u.prefixes > q.prefixes {
+		errs = append(errs, fmt.Sprintf("%d address prefixes exceed %s limit %d", u.prefixes, cloud, q.prefixes))
+	}
+	return errs
+}
+
+// checkQuota fails fast when group exceeds provider limits, unless group
+// is going to be split.
+func checkQuota(me, cloud, name string, gr *group, opts pushOptions) error {
+	errs := quotaErrors(cloud, gr, quotaFor(cloud))
+	if len(errs) < 1 {
+		return nil
+	}
+
+	for _, e := range errs {
+		slog.Error("quota exceeded", "cloud", cloud, "group", name, "error", e)
+	}
+
+	if !opts.split {
+		return fmt.Errorf("group=%s exceeds %s quota (%d errors), refusing to push (see --split)", name, cloud, len(errs))
+	}
+
+	if cloud == "azure" {
+		// a subnet or NIC takes a single NSG, and deny/priority order does not cross NSGs
+		return fmt.Errorf("group=%s exceeds %s quota: split not supported for azure", name, cloud)
+	}
+
+	slog.Info("splitting into numbered groups", "cloud", cloud, "group", name)
+
+	return nil
+}
+
+// groupPart is a provider group to push.
+type groupPart struct {
+	name string
+	gr   *group
+}
+
+// pushParts returns the group itself when it fits provider quota,
+// otherwise numbered groups name-1, name-2... each within quota.
+// Providers allowing many groups per instance apply the union of the parts.
+func pushParts(me, cloud, name string, gr *group, opts pushOptions) []groupPart {
+	q := quotaFor(cloud)
+
+	if !opts.split || len(quotaErrors(cloud, gr, q)) < 1 {
+		return []groupPart{{name: name, gr: gr}}
+	}
+
+	split := splitGroup(gr, q)
+
+	var parts []groupPart
+	for i := range split {
+		partName := fmt.Sprintf("%s-%d", name, i+1)
+		parts = append(parts, groupPart{name: partName, gr: &split[i]})
+		u := providerUsage(cloud, &split[i])
+		slog.Info("group part", "cloud", cloud, "group", name, "part", partName, "ingress", u.rulesIn, "egress", u.rulesOut)
+	}
+
+	return parts
+}
+
+// warnSplitOriginal warns when a group pushed as numbered parts still
+// exists under its own name: it keeps its old rules, which are now stale.
+// It is not emptied, since instances may still rely on it until the parts
+// are attached.
+func warnSplitOriginal(cloud, name string, parts []groupPart, fetch func() (*group, error)) {
+	if len(parts) < 2 {
+		return // pushed under its own name
+	}
+	_, errFetch := fetch()
+	switch {
+	case errFetch == nil:
+		slog.Warn("group was split into numbered parts, original group is stale: attach the parts, then delete it", "cloud", cloud, "group", name, "parts", len(parts))
+	case errors.Is(errFetch, errGroupNotFound):
+	default:
+		slog.Warn("group was split into numbered parts, could not check original group", "cloud", cloud, "group", name, "error", errFetch)
+	}
+}
+
+// splitGroup distributes group entries into groups within quota.
+// Every block and remote group reference is moved as a single entry.
+func splitGroup(gr *group, q quota) []group {
+	newPart := func() group {
+		return group{
+			APIVersion:  gr.APIVersion,
+			Kind:        gr.Kind,
+			Description: gr.Description,
+			Owner:       gr.Owner,
+			Ticket:      gr.Ticket,
+			Tags:        gr.Tags,
+		}
+	}
+
+	var parts []group
+	cur := newPart()
+	var countIn, countOut int
+
+	for _, dir := range []string{"in", "out"} {
+		ruleList := gr.RulesIn
+		if dir == "out" {
+			ruleList = gr.RulesOut
+		}
+		for _, r := range ruleList {
+			last := -1 // index in current part of rule holding entries of r
+			for _, e := range ruleEntries(r) {
+				full := q.rules > 0 && countIn+countOut >= q.rules
+				if dir == "in" {
+					full = full || (q.rulesIn > 0 && countIn >= q.rulesIn)
+				} else {
+					full = full || (q.rulesOut > 0 && countOut >= q.rulesOut)
+				}
+				if full {
+					parts = append(parts, cur)
+					cur = newPart()
+					countIn, countOut = 0, 0
+					last = -1
+				}
+
+				list := &cur.RulesIn
+				if dir == "out" {
+					list = &cur.RulesOut
+				}
+				if last < 0 {
+					*list = append(*list, e)
+					last = len(*list) - 1
+				} else {
+					mergeEntry(&(*list)[last], e)
+				}
+
+				if dir == "in" {
+					countIn++
+				} else {
+					countOut++
+				}
+			}
+		}
+	}
+
+	return append(parts, cur)
+}
+
+// ruleEntries breaks rule into rules holding a single provider entry.
+func ruleEntries(r rule) []rule {
+	base := r
+	base.Blocks, base.BlocksV6 = nil, nil
+	base.Aws, base.Openstack = nil, nil
+	if r.Openstack != nil {
+		ext := *r.Openstack
+		ext.RemoteGroupID = ""
+		base.Openstack = &ext
+	}
+
+	var entries []rule
+	for _, b := range r.Blocks {
+		e := base
+		e.Blocks = []block{b}
+		entries = append(entries, e)
+	}
+	for _, b := range r.BlocksV6 {
+		e := base
+		e.BlocksV6 = []block{b}
+		entries = append(entries, e)
+	}
+	if r.Aws != nil {
+		for _, ref := range r.Aws.GroupRefs {
+			e := base
+			e.Aws = &ruleAws{GroupRefs: []string{ref}}
+			entries = append(entries, e)
+		}
+	}
+	if r.Openstack != nil && r.Openstack.RemoteGroupID != "" {
+		e := base
+		e.Openstack = r.Openstack
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// mergeEntry adds entry from same source rule back into r.
+func mergeEntry(r *rule, e rule) {
+	r.Blocks = append(r.Blocks, e.Blocks...)
+	r.BlocksV6 = append(r.BlocksV6, e.BlocksV6...)
+	if e.Aws != nil {
+		if r.Aws == nil {
+			r.Aws = &ruleAws{}
+		}
+		r.Aws.GroupRefs = append(r.Aws.GroupRefs, e.Aws.GroupRefs...)
+	}
+	if e.Openstack != nil && e.Openstack.RemoteGroupID != "" {
+		r.Openstack = e.Openstack
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/gophercloud/gophercloud"
+)
+
+// retryPolicy is shared by cloud calls of all providers.
+type retryPolicy struct {
+	attempts int           // total attempts per call, 1 disables retry
+	base     time.Duration // backoff before first retry, doubled on every retry
+	max      time.Duration // backoff cap
+}
+
+// defaultRetries is the number of retries unless --retries is given.
+const defaultRetries = 4
+
+var retry = retryPolicy{attempts: defaultRetries + 1, base: 500 * time.Millisecond, max: 30 * time.Second}
+
+// errClass classifies cloud call errors.
+type errClass int
+
+const (
+	classFatal     errClass = iota // never retried
+	classThrottle                  // provider rate limit
+	classTransient                 // network error or provider fault
+	classConflict                  // group changed under lake, retrying same call does not help
+)
+
+func (c errClass) String() string {
+	switch c {
+	case classThrottle:
+		return "throttle"
+	case classTransient:
+		return "transient"
+	case classConflict:
+		return "conflict"
+	}
+	return "fatal"
+}
+
+func (c errClass) retryable() bool {
+	return c == classThrottle || c == classTransient
+}
+
+// backoff returns delay before retry n (1 for first retry): exponential
+// with jitter, between half and full of base*2^(n-1), capped by max.
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.base
+	for i := 1; i < n && d < p.max; i++ {
+		d *= 2
+	}
+	if d > p.max {
+		d = p.max
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func logRetry(cloud, op string, class errClass, attempt int, delay time.Duration, err error) {
+	slog.Warn("retrying cloud call", "cloud", cloud, "call", op, "class", class.String(), "attempt", attempt, "attempts", retry.attempts, "delay", delay, "error", err)
+}
+
+// classifyNet classifies transport errors.
+func classifyNet(err error) errClass {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return classFatal
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return classTransient
+	}
+	return classFatal
+}
+
+// classifyStatus classifies HTTP responses of Azure and OpenStack.
+func classifyStatus(status int) errClass {
+	switch status {
+	case http.StatusTooManyRequests:
+		return classThrottle
+	case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return classTransient
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return classConflict
+	}
+	return classFatal
+}
+
+// awsConflictCodes mark EC2 errors caused by group state.
+var awsConflictCodes = map[string]bool{
+	"InvalidPermission.Duplicate": true,
+	"InvalidGroup.Duplicate":      true,
+	"InvalidGroup.InUse":          true,
+	"DependencyViolation":         true,
+	"IncorrectState":              true,
+}
+
+func classifyAws(err error) errClass {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == aws.ErrCodeRequestCanceled {
+		return classFatal
+	}
+	if aws.IsErrorThrottle(err) {
+		return classThrottle
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.StatusCode() == http.StatusTooManyRequests:
+			return classThrottle
+		case reqErr.StatusCode() >= 500:
+			return classTransient
+		}
+	}
+	if aws.IsErrorRetryable(err) {
+		return classTransient
+	}
+	if awsErr != nil && awsConflictCodes[awsErr.Code()] {
+		return classConflict
+	}
+	return classFatal
+}
+
+// awsRetryer applies retry policy to AWS SDK requests.
+type awsRetryer struct{}
+
+func (awsRetryer) MaxRetries() int {
+	return retry.attempts - 1
+}
+
+func (awsRetryer) ShouldRetry(r *aws.Request) bool {
+	return classifyAws(r.Error).retryable()
+}
+
+func (awsRetryer) RetryRules(r *aws.Request) time.Duration {
+	delay := retry.backoff(r.RetryCount + 1)
+	logRetry("aws", r.Operation.Name, classifyAws(r.Error), r.RetryCount+1, delay, r.Error)
+	return delay
+}
+
+// loadConfigAws loads AWS config with retry policy.
+func loadConfigAws() (aws.Config, error) {
+	cfg, errConf := external.LoadDefaultAWSConfig()
+	if errConf != nil {
+		return cfg, errConf
+	}
+	cfg.Retryer = awsRetryer{}
+	return cfg, nil
+}
+
+// retryAzure applies retry policy to Azure client, replacing autorest retries.
+func retryAzure(c *autorest.Client) {
+	next := c.Sender
+	if next == nil {
+		next = &http.Client{}
+	}
+	c.Sender = autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+		return retryHTTP("azure", req, next.Do)
+	})
+	c.RetryAttempts = 1 // autorest sends once, wrapped Sender retries
+}
+
+// retryTransport applies retry policy to OpenStack HTTP client.
+type retryTransport struct {
+	cloud string
+	next  http.RoundTripper
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return retryHTTP(t.cloud, req, t.next.RoundTrip)
+}
+
+// retryOpenstack applies retry policy to OpenStack provider.
+func retryOpenstack(provider *gophercloud.ProviderClient) {
+	next := provider.HTTPClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	provider.HTTPClient.Transport = retryTransport{cloud: "openstack", next: next}
+}
+
+// retryHTTP sends request, retrying throttled and transient failures.
+// Requests whose body cannot be replayed are sent once.
+// Non-idempotent requests are retried only when throttled.
+func retryHTTP(cloud string, req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	op := req.Method + " " + req.URL.Path
+	for attempt := 1; ; attempt++ {
+		resp, err := send(req)
+
+		class := classFatal
+		if err != nil {
+			class = classifyNet(err)
+		} else if resp.StatusCode >= 400 {
+			class = classifyStatus(resp.StatusCode)
+		}
+
+		replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if !class.retryable() || attempt >= retry.attempts || !replayable || !retryMethod(req.Method, class) {
+			if attempt > 1 && err == nil && resp.StatusCode < 400 {
+				slog.Info("cloud call succeeded after retries", "cloud", cloud, "call", op, "retries", attempt-1)
+			}
+			return resp, err
+		}
+
+		delay := retry.backoff(attempt)
+		callErr := err
+		if resp != nil {
+			if after := retryAfter(resp); after > delay {
+				delay = after
+			}
+			callErr = errors.New(resp.Status)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		logRetry(cloud, op, class, attempt, delay, callErr)
+
+		ctx := req.Context()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if req.GetBody != nil {
+			body, errBody := req.GetBody()
+			if errBody != nil {
+				return nil, errBody
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// retryMethod reports whether request method may be sent again after failure.
+// A POST whose response was lost may have created a rule already, so
+// only throttle responses, refused before any change, are retried.
+func retryMethod(method string, class errClass) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return class == classThrottle
+}
+
+// retryAfter returns delay asked by Retry-After header in seconds, capped by policy.
+func retryAfter(resp *http.Response) time.Duration {
+	secs, errConv := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if errConv != nil || secs < 1 {
+		return 0
+	}
+	d := time.Duration(secs) * time.Second
+	if d > retry.max {
+		d = retry.max
+	}
+	return d
+}
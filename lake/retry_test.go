@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestRetryAzureSendsOnce(t *testing.T) {
+	var sent int
+	fake := autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+		sent++
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	c := autorest.NewClientWithUserAgent("test")
+	c.Sender = fake
+	retryAzure(&c)
+
+	req, errReq := http.NewRequest(http.MethodGet, "https://management.azure.com/test", nil)
+	if errReq != nil {
+		t.Fatal(errReq)
+	}
+
+	// generated clients send through DoRetryWithRegistration
+	resp, errSend := autorest.SendWithSender(c, req, azure.DoRetryWithRegistration(c))
+	if errSend != nil {
+		t.Fatalf("send: %v", errSend)
+	}
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("response: %v", resp)
+	}
+	if sent != 1 {
+		t.Errorf("sent %d requests, want 1", sent)
+	}
+}
+
+func TestRetryHTTPMethods(t *testing.T) {
+	saved := retry
+	defer func() { retry = saved }()
+	retry = retryPolicy{attempts: 3, base: time.Millisecond, max: time.Millisecond}
+
+	table := []struct {
+		method string
+		status int
+		want   int // requests sent
+	}{
+		{http.MethodGet, http.StatusServiceUnavailable, 3},
+		{http.MethodDelete, http.StatusBadGateway, 3},
+		{http.MethodPost, http.StatusServiceUnavailable, 1},
+		{http.MethodPost, http.StatusTooManyRequests, 3},
+		{http.MethodPost, http.StatusConflict, 1},
+		{http.MethodGet, http.StatusOK, 1},
+	}
+
+	for _, data := range table {
+		var sent int
+		send := func(req *http.Request) (*http.Response, error) {
+			sent++
+			return &http.Response{StatusCode: data.status, Status: http.StatusText(data.status), Body: http.NoBody, Header: http.Header{}, Request: req}, nil
+		}
+		req, errReq := http.NewRequest(data.method, "https://example.com/v2.0/security-group-rules", strings.NewReader("{}"))
+		if errReq != nil {
+			t.Fatal(errReq)
+		}
+		if _, errSend := retryHTTP("openstack", req, send); errSend != nil {
+			t.Errorf("%s %d: %v", data.method, data.status, errSend)
+		}
+		if sent != data.want {
+			t.Errorf("%s %d: sent %d requests, want %d", data.method, data.status, sent, data.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Current YAML schema header.
+const (
+	schemaAPIVersion = "lake/v2"
+	schemaKind       = "SecurityGroup"
+)
+
+// migration upgrades group from one schema version to the next.
+type migration struct {
+	from  string
+	to    string
+	apply func(gr *group)
+}
+
+// migrations lists upgrade steps, oldest first.
+// Files without apiVersion predate the header.
+var migrations = []migration{
+	{from: "", to: "lake/v1", apply: migrateV0},
+	{from: "lake/v1", to: "lake/v2", apply: migrateV1},
+}
+
+// migrate upgrades group to current schema version.
+// It refuses unknown versions, including newer ones.
+func (g *group) migrate() (bool, error) {
+	if g.Kind != "" && g.Kind != schemaKind {
+		return false, fmt.Errorf("unsupported kind=%s (expecting %s)", g.Kind, schemaKind)
+	}
+
+	var migrated bool
+
+	for g.APIVersion != schemaAPIVersion {
+		m, found := findMigration(g.APIVersion)
+		if !found {
+			return migrated, fmt.Errorf("unsupported apiVersion=%s (this lake supports up to %s, maybe the file is newer)",
+				g.APIVersion, schemaAPIVersion)
+		}
+		slog.Info("migrating schema", "from", m.from, "to", m.to)
+		m.apply(g)
+		g.APIVersion = m.to
+		migrated = true
+	}
+
+	g.Kind = schemaKind
+
+	return migrated, nil
+}
+
+func findMigration(from string) (migration, bool) {
+	for _, m := range migrations {
+		if m.from == from {
+			return m, true
+		}
+	}
+	return migration{}, false
+}
+
+// migrateV0 moves flat provider description fields into portable Description.
+func migrateV0(g *group) {
+	for _, list := range [][]rule{g.RulesIn, g.RulesOut} {
+		for i := range list {
+			r := &list[i]
+			if r.Description == "" {
+				r.Description = r.AzureDescription
+			}
+			r.AzureDescription = ""
+			for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+				for j := range blocks {
+					b := &blocks[j]
+					if b.Description == "" {
+						b.Description = b.AwsDescription
+					}
+					b.AwsDescription = ""
+				}
+			}
+			if r.Description == "" {
+				joinDescriptions(r)
+			}
+		}
+	}
+}
+
+// migrateV1 moves flat Azure*/Aws* fields into provider extensions.
+// Magic AzurePush values "*" and "<skip>" are dropped since push derives
+// azure "*" from blocks 0.0.0.0/0 plus ::/0. AzureSingle is dropped since
+// push picks single prefix for single address.
+func migrateV1(g *group) {
+	for _, list := range [][]rule{g.RulesIn, g.RulesOut} {
+		for i := range list {
+			r := &list[i]
+			if r.AzureName != "" || r.AzurePriority != 0 || r.AzureDeny ||
+				r.AzureSourcePortRange != "" || len(r.AzureSourcePortRanges) > 0 ||
+				r.AzureDestinationAddressPrefix != "" || len(r.AzureDestinationAddressPrefixes) > 0 {
+				r.Azure = &ruleAzure{
+					Name:                       r.AzureName,
+					Priority:                   r.AzurePriority,
+					Deny:                       r.AzureDeny,
+					SourcePortRange:            r.AzureSourcePortRange,
+					SourcePortRanges:           r.AzureSourcePortRanges,
+					DestinationAddressPrefix:   r.AzureDestinationAddressPrefix,
+					DestinationAddressPrefixes: r.AzureDestinationAddressPrefixes,
+				}
+			}
+			if r.Description == "" {
+				r.Description = r.AzureDescription
+			}
+			r.AzureName = ""
+			r.AzurePriority = 0
+			r.AzureDeny = false
+			r.AzureDescription = ""
+			r.AzureSourcePortRange = ""
+			r.AzureSourcePortRanges = nil
+			r.AzureDestinationAddressPrefix = ""
+			r.AzureDestinationAddressPrefixes = nil
+
+			for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+				for j := range blocks {
+					b := &blocks[j]
+					switch {
+					case b.AwsDescription == "":
+					case b.Description == "":
+						b.Description = b.AwsDescription
+					case b.Description != b.AwsDescription:
+						b.Aws = &blockAws{Description: b.AwsDescription}
+					}
+					switch b.AzurePush {
+					case "", "*", "<skip>", b.Address:
+					default:
+						b.Azure = &blockAzure{Address: b.AzurePush}
+					}
+					b.AwsDescription = ""
+					b.AzurePush = ""
+					b.AzureSingle = false
+				}
+			}
+		}
+	}
+}
+
+func cmdMigrate(me string, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	inPlace := fs.Bool("in-place", false, "rewrite file instead of writing to stdout")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	if len(positional) < 1 {
+		return fmt.Errorf("migrate: missing file")
+	}
+
+	for _, path := range positional {
+		var gr group
+		if errLoad := readGroupFile(me, path, &gr); errLoad != nil {
+			return fmt.Errorf("migrate: %s: %v", path, errLoad)
+		}
+
+		if !*inPlace || path == "-" {
+			gr.output()
+			continue
+		}
+
+		buf, errYaml := gr.yaml()
+		if errYaml != nil {
+			return fmt.Errorf("migrate: %s: %v", path, errYaml)
+		}
+
+		if errWrite := os.WriteFile(path, buf, 0644); errWrite != nil {
+			return fmt.Errorf("migrate: %v", errWrite)
+		}
+
+		slog.Info("file rewritten", "file", path, "apiVersion", schemaAPIVersion)
+	}
+
+	return nil
+}
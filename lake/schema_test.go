@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	current := group{
+		APIVersion: schemaAPIVersion,
+		Kind:       schemaKind,
+		RulesIn: []rule{
+			{
+				Description: "web",
+				Protocol:    "tcp",
+				PortFirst:   443,
+				PortLast:    443,
+				Blocks: []block{
+					{Address: "10.0.0.0/8", Description: "corp"},
+					{Address: "192.168.0.0/16", Description: "lab", Aws: &blockAws{Description: "lab aws"}},
+					{Address: "172.16.0.0/12", Azure: &blockAzure{Address: "VirtualNetwork"}},
+				},
+				Azure: &ruleAzure{Name: "web", Priority: 100, SourcePortRange: "*"},
+			},
+		},
+		RulesOut: []rule{
+			{
+				Description: "any",
+				Blocks:      []block{{Address: "0.0.0.0/0"}},
+			},
+		},
+	}
+
+	// v0 had no aws-only block description
+	v0 := current
+	v0.RulesIn = []rule{current.RulesIn[0]}
+	v0.RulesIn[0].Blocks = append([]block{}, current.RulesIn[0].Blocks...)
+	v0.RulesIn[0].Blocks[1].Aws = nil
+
+	table := []struct {
+		name string
+		file string
+		want group
+	}{
+		{
+			name: "v0 without header",
+			want: v0,
+			file: `
+rulesin:
+- protocol: tcp
+  portfirst: 443
+  portlast: 443
+  azurename: web
+  azurepriority: 100
+  azuredescription: web
+  azuresourceportrange: "*"
+  blocks:
+  - address: 10.0.0.0/8
+    awsdescription: corp
+  - address: 192.168.0.0/16
+    awsdescription: lab
+  - address: 172.16.0.0/12
+    azurepush: VirtualNetwork
+rulesout:
+- blocks:
+  - address: 0.0.0.0/0
+    awsdescription: any
+`,
+		},
+		{
+			name: "v1",
+			want: current,
+			file: `
+apiVersion: lake/v1
+kind: SecurityGroup
+rulesin:
+- description: web
+  protocol: tcp
+  portfirst: 443
+  portlast: 443
+  azurename: web
+  azurepriority: 100
+  azuresourceportrange: "*"
+  blocks:
+  - address: 10.0.0.0/8
+    description: corp
+  - address: 192.168.0.0/16
+    description: lab
+    awsdescription: lab aws
+  - address: 172.16.0.0/12
+    azurepush: VirtualNetwork
+rulesout:
+- description: any
+  blocks:
+  - address: 0.0.0.0/0
+    azurepush: "*"
+`,
+		},
+		{
+			name: "current",
+			want: current,
+			file: `
+apiVersion: lake/v2
+kind: SecurityGroup
+rulesin:
+- description: web
+  protocol: tcp
+  portfirst: 443
+  portlast: 443
+  blocks:
+  - address: 10.0.0.0/8
+    description: corp
+  - address: 192.168.0.0/16
+    description: lab
+    aws:
+      description: lab aws
+  - address: 172.16.0.0/12
+    azure:
+      address: VirtualNetwork
+  azure:
+    name: web
+    priority: 100
+    sourceportrange: "*"
+rulesout:
+- description: any
+  blocks:
+  - address: 0.0.0.0/0
+`,
+		},
+	}
+
+	for _, data := range table {
+		var gr group
+		if errDec := groupFromReader(strings.NewReader(data.file), &gr); errDec != nil {
+			t.Errorf("%s: %v", data.name, errDec)
+			continue
+		}
+		if !reflect.DeepEqual(gr, data.want) {
+			t.Errorf("%s: got %+v, want %+v", data.name, gr, data.want)
+		}
+
+		// loaded group is current, so migrating again does nothing
+		migrated, errMigrate := gr.migrate()
+		if errMigrate != nil || migrated {
+			t.Errorf("%s: migrated again: %v %v", data.name, migrated, errMigrate)
+		}
+	}
+}
+
+func TestMigrateSteps(t *testing.T) {
+	for _, data := range []struct {
+		apiVersion string
+		migrated   bool
+	}{{"", true}, {"lake/v1", true}, {schemaAPIVersion, false}} {
+		gr := group{APIVersion: data.apiVersion}
+		migrated, errMigrate := gr.migrate()
+		if errMigrate != nil || migrated != data.migrated || gr.APIVersion != schemaAPIVersion || gr.Kind != schemaKind {
+			t.Errorf("apiVersion=%q: migrated=%v apiVersion=%s kind=%s error=%v", data.apiVersion, migrated, gr.APIVersion, gr.Kind, errMigrate)
+		}
+	}
+}
+
+func TestMigrateRefuse(t *testing.T) {
+	for _, file := range []string{
+		"apiVersion: lake/v9\nkind: SecurityGroup\n",
+		"apiVersion: lake/v2\nkind: Firewall\n",
+	} {
+		var gr group
+		if errDec := groupFromReader(strings.NewReader(file), &gr); errDec == nil {
+			t.Errorf("accepted: %q", file)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// searchFilter selects rules. Empty fields match anything.
+type searchFilter struct {
+	cidr      string // remote block overlapping cidr; world cidr matches only world blocks
+	port      int64  // destination port covered by rule
+	proto     string // protocol
+	direction string // in|out|both
+}
+
+// searchSource is a group to search, either live or from file.
+type searchSource struct {
+	label string // cloud:name@scope or file path
+	ref   groupRef
+	file  string
+}
+
+type searchHit struct {
+	direction string
+	index     int // rule index within RulesIn/RulesOut
+	r         rule
+	blocks    []string // blocks matching cidr
+}
+
+type searchResult struct {
+	hits []searchHit
+	err  error
+}
+
+func cmdSearch(me string, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	cidr := fs.String("cidr", "", "remote block overlapping cidr")
+	port := fs.Int64("port", 0, "destination port")
+	proto := fs.String("proto", "", "protocol")
+	nameGlob := fs.String("name-glob", "", "group name pattern")
+	direction := fs.String("direction", "both", "rule direction: in|out|both")
+	workers := fs.Int("workers", 8, "groups loaded concurrently")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	if len(positional) < 1 {
+		return fmt.Errorf("search: need cloud [scope] or directory")
+	}
+
+	switch *direction {
+	case "in", "out", "both":
+	default:
+		return fmt.Errorf("search: bad direction: %s", *direction)
+	}
+
+	if *cidr != "" && !blockIsWorld(*cidr) {
+		if _, errNet := blockNet(*cidr); errNet != nil {
+			return fmt.Errorf("search: bad cidr: %s: %v", *cidr, errNet)
+		}
+	}
+
+	if *nameGlob != "" {
+		if _, errGlob := path.Match(*nameGlob, ""); errGlob != nil {
+			return fmt.Errorf("search: bad name glob: %s: %v", *nameGlob, errGlob)
+		}
+	}
+
+	if *workers < 1 {
+		return fmt.Errorf("search: bad workers: %d", *workers)
+	}
+
+	f := searchFilter{
+		cidr:      *cidr,
+		port:      *port,
+		proto:     *proto,
+		direction: *direction,
+	}
+
+	var sources []searchSource
+	var errSources error
+	if isCloud(positional[0]) {
+		sources, errSources = searchSourcesCloud(positional[0], positional[1:], *nameGlob)
+	} else {
+		sources, errSources = searchSourcesDir(positional[0], *nameGlob)
+	}
+	if errSources != nil {
+		return errSources
+	}
+
+	results := searchGroups(me, sources, f, *workers)
+
+	var failed, matched, rules int
+	for i, res := range results {
+		src := sources[i]
+		if res.err != nil {
+			slog.Error("search: group not loaded", "group", src.label, "error", res.err)
+			failed++
+			continue
+		}
+		if len(res.hits) > 0 {
+			matched++
+		}
+		for _, h := range res.hits {
+			var blocks string
+			if len(h.blocks) > 0 {
+				blocks = " blocks=" + strings.Join(h.blocks, ",")
+			}
+			fmt.Printf("match: %s direction=%s rule=%d %s%s\n", src.label, h.direction, h.index, h.r.describe(), blocks)
+			rules++
+		}
+	}
+
+	fmt.Printf("search: %d rule(s) in %d of %d group(s)\n", rules, matched, len(sources))
+
+	if failed > 0 {
+		return fmt.Errorf("search: %d of %d group(s) not loaded", failed, len(sources))
+	}
+
+	return nil
+}
+
+// searchSourcesCloud lists groups in cloud, within scope when given.
+func searchSourcesCloud(cloud string, args []string, nameGlob string) ([]searchSource, error) {
+	var scope string
+	if len(args) > 0 {
+		scope = args[0]
+	}
+
+	var records []groupRecord
+	var errList error
+	switch cloud {
+	case "aws":
+		records, errList = listRecordsAws(scope, false)
+	case "azure":
+		records, errList = listRecordsAzure(false)
+	case "openstack":
+		groupRef{cloud: cloud, scope: scope}.setRegion()
+		records, errList = listRecordsOpenstack(false)
+	}
+	if errList != nil {
+		return nil, errList
+	}
+
+	var sources []searchSource
+	for _, rec := range records {
+		if cloud == "azure" && scope != "" && !strings.EqualFold(rec.Scope, scope) {
+			continue
+		}
+		if !matchName(nameGlob, rec.Name) {
+			continue
+		}
+		ref := groupRef{cloud: cloud, name: rec.Name, scope: rec.Scope}
+		sources = append(sources, searchSource{label: ref.String(), ref: ref})
+	}
+
+	return sources, nil
+}
+
+// searchSourcesDir finds group files under dir.
+// Group name is file name without extension.
+func searchSourcesDir(dir, nameGlob string) ([]searchSource, error) {
+	info, errStat := os.Stat(dir)
+	if errStat != nil {
+		return nil, errStat
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("search: not a cloud or directory: %s", dir)
+	}
+
+	var sources []searchSource
+	errWalk := filepath.Walk(dir, func(p string, fi os.FileInfo, errPath error) error {
+		if errPath != nil {
+			return errPath
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(p)
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		if !matchName(nameGlob, strings.TrimSuffix(fi.Name(), ext)) {
+			return nil
+		}
+		sources = append(sources, searchSource{label: p, file: p})
+		return nil
+	})
+
+	return sources, errWalk
+}
+
+func matchName(glob, name string) bool {
+	if glob == "" {
+		return true
+	}
+	found, _ := path.Match(glob, name)
+	return found
+}
+
+// searchGroups loads sources concurrently and searches each group.
+// Results keep sources order.
+func searchGroups(me string, sources []searchSource, f searchFilter, workers int) []searchResult {
+	results := make([]searchResult, len(sources))
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i := range sources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			src := sources[i]
+			var gr *group
+			var errLoad error
+			if src.file != "" {
+				gr = &group{}
+				errLoad = groupFromFile(me, src.file, gr)
+			} else {
+				gr, errLoad = groupFromCloud(me, src.ref.cloud, src.ref.pullArgs())
+			}
+			if errLoad != nil {
+				results[i].err = errLoad
+				return
+			}
+			results[i].hits = gr.search(f)
+		}(i)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func (g *group) search(f searchFilter) []searchHit {
+	var hits []searchHit
+	g.eachRule(func(dir string, i int, r *rule) {
+		if f.direction != "both" && f.direction != dir {
+			return
+		}
+		if blocks, found := f.matchRule(*r); found {
+			hits = append(hits, searchHit{direction: dir, index: i, r: *r, blocks: blocks})
+		}
+	})
+	return hits
+}
+
+// matchRule reports whether rule matches filter, with blocks matching cidr.
+func (f searchFilter) matchRule(r rule) ([]string, bool) {
+	if f.proto != "" && !protoAny(r.Protocol) && !protoEqual(r.Protocol, f.proto) {
+		return nil, false
+	}
+	if f.port > 0 {
+		if protoIcmp(r.Protocol) {
+			return nil, false // ICMP ports carry type/code, not ports
+		}
+		if !r.portsAny() && (f.port < r.PortFirst || f.port > r.PortLast) {
+			return nil, false
+		}
+	}
+	if f.cidr == "" {
+		return nil, true
+	}
+	var blocks []string
+	for _, list := range [][]block{r.Blocks, r.BlocksV6} {
+		for _, b := range list {
+			if blockOverlapsForbidden(b.Address, f.cidr) {
+				blocks = append(blocks, b.Address)
+			}
+		}
+	}
+	return blocks, len(blocks) > 0
+}
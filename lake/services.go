@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// servicePorts is one protocol entry of a service alias.
+type servicePorts struct {
+	Protocol string
+	Ports    []string // "443" or "8000-8100"
+}
+
+// builtinServices is the default service table, extended by files from env var LAKE_SERVICES.
+var builtinServices = map[string][]servicePorts{
+	"dns":           {{Protocol: "udp", Ports: []string{"53"}}, {Protocol: "tcp", Ports: []string{"53"}}},
+	"elasticsearch": {{Protocol: "tcp", Ports: []string{"9200"}}},
+	"http":          {{Protocol: "tcp", Ports: []string{"80"}}},
+	"https":         {{Protocol: "tcp", Ports: []string{"443"}}},
+	"imap":          {{Protocol: "tcp", Ports: []string{"143"}}},
+	"imaps":         {{Protocol: "tcp", Ports: []string{"993"}}},
+	"kubernetes":    {{Protocol: "tcp", Ports: []string{"6443"}}},
+	"ldap":          {{Protocol: "tcp", Ports: []string{"389"}}},
+	"ldaps":         {{Protocol: "tcp", Ports: []string{"636"}}},
+	"mongodb":       {{Protocol: "tcp", Ports: []string{"27017"}}},
+	"mssql":         {{Protocol: "tcp", Ports: []string{"1433"}}},
+	"mysql":         {{Protocol: "tcp", Ports: []string{"3306"}}},
+	"ntp":           {{Protocol: "udp", Ports: []string{"123"}}},
+	"oracle":        {{Protocol: "tcp", Ports: []string{"1521"}}},
+	"pop3":          {{Protocol: "tcp", Ports: []string{"110"}}},
+	"pop3s":         {{Protocol: "tcp", Ports: []string{"995"}}},
+	"postgresql":    {{Protocol: "tcp", Ports: []string{"5432"}}},
+	"rdp":           {{Protocol: "tcp", Ports: []string{"3389"}}},
+	"redis":         {{Protocol: "tcp", Ports: []string{"6379"}}},
+	"smb":           {{Protocol: "tcp", Ports: []string{"445"}}},
+	"smtp":          {{Protocol: "tcp", Ports: []string{"25"}}},
+	"smtps":         {{Protocol: "tcp", Ports: []string{"465"}}},
+	"snmp":          {{Protocol: "udp", Ports: []string{"161"}}},
+	"ssh":           {{Protocol: "tcp", Ports: []string{"22"}}},
+	"submission":    {{Protocol: "tcp", Ports: []string{"587"}}},
+	"syslog":        {{Protocol: "udp", Ports: []string{"514"}}},
+}
+
+// loadServices returns builtin service table extended by files from env var LAKE_SERVICES.
+func loadServices() (map[string][]servicePorts, error) {
+	table := map[string][]servicePorts{}
+	for name, entries := range builtinServices {
+		table[name] = entries
+	}
+
+	env := os.Getenv("LAKE_SERVICES")
+	if env == "" {
+		return table, nil
+	}
+
+	for _, f := range filepath.SplitList(env) {
+		slog.Debug("loading services", "file", f)
+
+		buf, errRead := os.ReadFile(f)
+		if errRead != nil {
+			return nil, errRead
+		}
+
+		var custom map[string][]servicePorts
+		if errYaml := yaml.Unmarshal(buf, &custom); errYaml != nil {
+			return nil, fmt.Errorf("%s: %v", f, errYaml)
+		}
+
+		for name, entries := range custom {
+			for _, e := range entries {
+				for _, p := range e.Ports {
+					if _, _, errPort := parsePortRange(p); errPort != nil {
+						return nil, fmt.Errorf("%s: service %s: %v", f, name, errPort)
+					}
+				}
+			}
+			table[name] = entries // local file overrides builtin
+		}
+	}
+
+	return table, nil
+}
+
+// parsePortRange parses "443" or "8000-8100".
+func parsePortRange(s string) (int64, int64, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "-", 2)
+	first, errFirst := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if errFirst != nil {
+		return 0, 0, fmt.Errorf("bad port range: %s", s)
+	}
+	last := first
+	if len(parts) > 1 {
+		var errLast error
+		last, errLast = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if errLast != nil {
+			return 0, 0, fmt.Errorf("bad port range: %s", s)
+		}
+	}
+	if first < 0 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("bad port range: %s", s)
+	}
+	return first, last, nil
+}
+
+func formatPortRange(first, last int64) string {
+	if first == last {
+		return strconv.FormatInt(first, 10)
+	}
+	return fmt.Sprintf("%d-%d", first, last)
+}
+
+// hasServices reports whether group uses service or ports shorthand.
+func (g *group) hasServices() bool {
+	for _, list := range [][]rule{g.RulesIn, g.RulesOut} {
+		for _, r := range list {
+			if r.Service != "" || len(r.Ports) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandServices turns service and ports shorthand into Protocol/PortFirst/PortLast rules.
+func (g *group) expandServices() error {
+	if !g.hasServices() {
+		return nil
+	}
+
+	table, errTable := loadServices()
+	if errTable != nil {
+		return errTable
+	}
+
+	rulesIn, errIn := expandServiceRules(table, g.RulesIn)
+	if errIn != nil {
+		return fmt.Errorf("RulesIn: %v", errIn)
+	}
+	rulesOut, errOut := expandServiceRules(table, g.RulesOut)
+	if errOut != nil {
+		return fmt.Errorf("RulesOut: %v", errOut)
+	}
+
+	g.RulesIn = rulesIn
+	g.RulesOut = rulesOut
+
+	return nil
+}
+
+func expandServiceRules(table map[string][]servicePorts, ruleList []rule) ([]rule, error) {
+	var result []rule
+
+	for i, r := range ruleList {
+		var entries []servicePorts
+
+		switch {
+		case r.Service != "" && len(r.Ports) > 0:
+			return nil, fmt.Errorf("rule %d: service and ports are exclusive", i)
+		case r.Service != "":
+			found := false
+			entries, found = table[r.Service]
+			if !found {
+				return nil, fmt.Errorf("rule %d: unknown service: %s", i, r.Service)
+			}
+			if r.Protocol != "" {
+				// explicit protocol selects service entries, and must be one of them
+				var selected []servicePorts
+				var protocols []string
+				for _, e := range entries {
+					protocols = append(protocols, e.Protocol)
+					if protoEqual(e.Protocol, r.Protocol) {
+						selected = append(selected, e)
+					}
+				}
+				if len(selected) < 1 {
+					return nil, fmt.Errorf("rule %d: protocol=%s disagrees with service %s (%s)", i, r.Protocol, r.Service, strings.Join(protocols, ","))
+				}
+				entries = selected
+			}
+		case len(r.Ports) > 0:
+			if protoAny(r.Protocol) {
+				return nil, fmt.Errorf("rule %d: ports require protocol", i)
+			}
+			entries = []servicePorts{{Protocol: r.Protocol, Ports: r.Ports}}
+		default:
+			result = append(result, r)
+			continue
+		}
+
+		for _, e := range entries {
+			for _, p := range e.Ports {
+				first, last, errPort := parsePortRange(p)
+				if errPort != nil {
+					return nil, fmt.Errorf("rule %d: %v", i, errPort)
+				}
+				expanded := r
+				expanded.Service = ""
+				expanded.Ports = nil
+				expanded.Protocol = e.Protocol
+				expanded.PortFirst = first
+				expanded.PortLast = last
+				result = append(result, expanded)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// collapseServices rewrites rules into service aliases and port lists.
+// Rules with azure extension keep their identity and are not collapsed.
+func (g *group) collapseServices() {
+	table, errTable := loadServices()
+	if errTable != nil {
+		slog.Warn("collapsing services", "error", errTable)
+		return
+	}
+
+	// index services made of single protocol and single port range
+	index := map[string]string{}
+	var names []string
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entries := table[name]
+		if len(entries) != 1 || len(entries[0].Ports) != 1 {
+			continue
+		}
+		first, last, errPort := parsePortRange(entries[0].Ports[0])
+		if errPort != nil {
+			continue
+		}
+		key := fmt.Sprintf("%s/%d-%d", protoNormalize(entries[0].Protocol), first, last)
+		if _, found := index[key]; !found {
+			index[key] = name
+		}
+	}
+
+	g.RulesIn = collapseServiceRules(index, g.RulesIn)
+	g.RulesOut = collapseServiceRules(index, g.RulesOut)
+}
+
+func collapseServiceRules(index map[string]string, ruleList []rule) []rule {
+	var result []rule
+	merged := map[string]int{} // rule signature => position in result
+
+	for _, r := range ruleList {
+		if r.Azure != nil || r.Service != "" || len(r.Ports) > 0 || protoAny(r.Protocol) || protoIcmp(r.Protocol) || r.portsAny() {
+			result = append(result, r)
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d-%d", protoNormalize(r.Protocol), r.PortFirst, r.PortLast)
+		if name, found := index[key]; found {
+			r.Service = name
+			r.Protocol = ""
+			r.PortFirst = 0
+			r.PortLast = 0
+			result = append(result, r)
+			continue
+		}
+
+		// merge rules differing only by port range into port list
+		sig := ruleSignature(r)
+		if pos, found := merged[sig]; found {
+			result[pos].Ports = append(result[pos].Ports, formatPortRange(r.PortFirst, r.PortLast))
+			continue
+		}
+		r.Ports = []string{formatPortRange(r.PortFirst, r.PortLast)}
+		r.PortFirst = 0
+		r.PortLast = 0
+		merged[sig] = len(result)
+		result = append(result, r)
+	}
+
+	// single entry port list is left as plain port range
+	for i := range result {
+		r := &result[i]
+		if len(r.Ports) == 1 {
+			r.PortFirst, r.PortLast, _ = parsePortRange(r.Ports[0])
+			r.Ports = nil
+		}
+	}
+
+	return result
+}
+
+// ruleSignature identifies rule fields other than port range.
+func ruleSignature(r rule) string {
+	r.PortFirst = 0
+	r.PortLast = 0
+	r.Protocol = protoNormalize(r.Protocol)
+	buf, _ := yaml.Marshal(r)
+	return string(buf)
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestExpandServiceProtocol(t *testing.T) {
+	table := []struct {
+		name    string
+		r       rule
+		want    []string // protocol of expanded rules
+		wantErr bool
+	}{
+		{"service only", rule{Service: "dns"}, []string{"udp", "tcp"}, false},
+		{"protocol agrees", rule{Service: "https", Protocol: "tcp"}, []string{"tcp"}, false},
+		{"protocol agrees by number", rule{Service: "https", Protocol: "6"}, []string{"tcp"}, false},
+		{"protocol selects entry", rule{Service: "dns", Protocol: "TCP"}, []string{"tcp"}, false},
+		{"protocol disagrees", rule{Service: "https", Protocol: "udp"}, nil, true},
+		{"all protocols disagrees", rule{Service: "ssh", Protocol: "all"}, nil, true},
+	}
+
+	for _, data := range table {
+		got, errExpand := expandServiceRules(builtinServices, []rule{data.r})
+		if (errExpand != nil) != data.wantErr {
+			t.Errorf("%s: error=%v, want error=%v", data.name, errExpand, data.wantErr)
+			continue
+		}
+		if len(got) != len(data.want) {
+			t.Errorf("%s: got %d rule(s), want %d", data.name, len(got), len(data.want))
+			continue
+		}
+		for i, r := range got {
+			if r.Protocol != data.want[i] {
+				t.Errorf("%s: rule %d: protocol=%s, want %s", data.name, i, r.Protocol, data.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"gopkg.in/yaml.v2"
+)
+
+// syncManifest declares all groups managed from a repository.
+type syncManifest struct {
+	Name   string      // manifest identity, stored as provider tag lake-manifest on synced groups
+	Groups []syncEntry // groups to reconcile
+}
+
+type syncEntry struct {
+	File     string // group file, relative to manifest
+	Cloud    string // aws|azure|openstack
+	Name     string // provider group name, defaults to file name without extension
+	Scope    string // aws vpc-id, azure resource group, openstack region
+	Location string // azure location
+}
+
+func (e syncEntry) ref() groupRef {
+	return groupRef{cloud: e.Cloud, name: e.Name, scope: e.Scope, location: e.Location}
+}
+
+func loadManifest(path string) (*syncManifest, error) {
+	buf, errRead := os.ReadFile(path)
+	if errRead != nil {
+		return nil, errRead
+	}
+
+	var m syncManifest
+	if errYaml := yaml.Unmarshal(buf, &m); errYaml != nil {
+		return nil, fmt.Errorf("manifest: %s: %v", path, errYaml)
+	}
+
+	if m.Name == "" {
+		return nil, fmt.Errorf("manifest: %s: missing name", path)
+	}
+
+	seen := map[string]bool{}
+	for i := range m.Groups {
+		e := &m.Groups[i]
+		if !isCloud(e.Cloud) {
+			return nil, fmt.Errorf("manifest: %s: groups[%d]: bad cloud: %s", path, i, e.Cloud)
+		}
+		if e.File == "" {
+			return nil, fmt.Errorf("manifest: %s: groups[%d]: missing file", path, i)
+		}
+		if e.Name == "" {
+			e.Name = strings.TrimSuffix(filepath.Base(e.File), filepath.Ext(e.File))
+		}
+		if errRef := checkRef(e.ref()); errRef != nil {
+			return nil, fmt.Errorf("manifest: %s: groups[%d]: %v", path, i, errRef)
+		}
+		key := e.ref().String()
+		if seen[key] {
+			return nil, fmt.Errorf("manifest: %s: groups[%d]: duplicate group: %s", path, i, key)
+		}
+		seen[key] = true
+	}
+
+	return &m, nil
+}
+
+const (
+	syncCreate    = "create"
+	syncUpdate    = "update"
+	syncUnchanged = "unchanged"
+	syncDelete    = "delete"
+)
+
+type syncAction struct {
+	action string
+	ref    groupRef
+	file   string
+	gr     *group
+	diff   groupDiff
+}
+
+func cmdSync(me string, args []string) error {
+	var pushOpts pushOptions
+
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	pushOpts.register(fs)
+	dryRun := fs.Bool("dry-run", false, "show plan without applying")
+	prune := fs.Bool("prune", false, "delete groups tagged by manifest but no longer listed")
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	if len(positional) != 1 {
+		return fmt.Errorf("sync: need manifest file")
+	}
+
+	manifestPath := positional[0]
+
+	m, errManifest := loadManifest(manifestPath)
+	if errManifest != nil {
+		return errManifest
+	}
+
+	plan, errPlan := planSync(me, m, filepath.Dir(manifestPath))
+	if errPlan != nil {
+		return errPlan
+	}
+
+	var stale []groupRef
+	if *prune {
+		var errStale error
+		stale, errStale = staleGroups(m)
+		if errStale != nil {
+			return errStale
+		}
+	}
+
+	var changes int
+	for _, a := range plan {
+		fmt.Printf("plan: %s %s (%s)\n", a.action, a.ref, a.file)
+		if a.action == syncUpdate {
+			a.diff.writeText()
+		}
+		if a.action != syncUnchanged {
+			changes++
+		}
+	}
+	for _, ref := range stale {
+		fmt.Printf("plan: %s %s (not in manifest)\n", syncDelete, ref)
+		plan = append(plan, syncAction{action: syncDelete, ref: ref})
+		changes++
+	}
+	fmt.Printf("plan: %d change(s)\n", changes)
+
+	if *dryRun {
+		return nil
+	}
+
+	var failed, applied int
+	for _, a := range plan {
+		if a.action != syncUnchanged {
+			if errStop := safePoint(); errStop != nil {
+				return fmt.Errorf("sync: stopped after %d of %d change(s), %d failed: %v", applied, changes, failed, errStop)
+			}
+			applied++
+		}
+		var errApply error
+		switch a.action {
+		case syncCreate, syncUpdate:
+			errApply = applyGroup(me, a.ref, a.gr, pushOpts)
+		case syncDelete:
+			errApply = deleteGroup(me, a.ref)
+		default:
+			continue
+		}
+		if errApply != nil {
+			slog.Error("sync failed", "cloud", a.ref.cloud, "group", a.ref.name, "scope", a.ref.scope, "action", a.action, "error", errApply)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("sync: %d of %d change(s) failed", failed, changes)
+	}
+
+	return nil
+}
+
+// planSync compares every manifest group against its live group.
+func planSync(me string, m *syncManifest, baseDir string) ([]syncAction, error) {
+	var plan []syncAction
+
+	for _, e := range m.Groups {
+		path := e.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		gr := &group{}
+		if errLoad := groupFromFile(me, path, gr); errLoad != nil {
+			return nil, errLoad
+		}
+
+		// mark group as managed by manifest, for pruning
+		if gr.Tags == nil {
+			gr.Tags = map[string]string{}
+		}
+		gr.Tags[tagManifest] = m.Name
+
+		ref := e.ref()
+		a := syncAction{ref: ref, file: e.File, gr: gr}
+
+		ref.setRegion()
+		live, errLive := groupFromCloud(me, ref.cloud, ref.pullArgs())
+		if errLive != nil {
+			if !errors.Is(errLive, errGroupNotFound) {
+				return nil, fmt.Errorf("sync: %s: %v", ref, errLive)
+			}
+			slog.Info("group not found, planning create", "cloud", ref.cloud, "group", ref.name, "scope", ref.scope)
+			a.action = syncCreate
+			plan = append(plan, a)
+			continue
+		}
+
+		a.diff = diffGroups(live, gr)
+		a.diff.From = ref.String()
+		a.diff.To = e.File
+
+		a.action = syncUnchanged
+		if !a.diff.empty() || metadataChanged(ref.cloud, live, gr) || settingsChanged(ref.cloud, live, gr) {
+			a.action = syncUpdate
+		}
+
+		plan = append(plan, a)
+	}
+
+	return plan, nil
+}
+
+// metadataChanged compares group fields stored by cloud besides rules.
+// Tags, owner and ticket are compared as pushed, after mapping to cloud limits.
+func metadataChanged(cloud string, live, gr *group) bool {
+	if cloud != "azure" && live.Description != gr.Description {
+		return true // azure has no group description
+	}
+	if cloud == "openstack" && gr.Openstack != nil && gr.Openstack.Stateful != nil && live.stateless() != gr.stateless() {
+		return true
+	}
+	if !gr.hasTags() {
+		return false // push leaves provider tags untouched
+	}
+	liveTags, _ := live.tagsForCloud(cloud) // drops reserved aws: tags
+	wantTags, _ := gr.tagsForCloud(cloud)
+	if len(liveTags) == 0 && len(wantTags) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(liveTags, wantTags)
+}
+
+// settingsChanged compares rule fields pushed to cloud which diffGroups
+// ignores: descriptions, and azure names, priorities, destination prefixes
+// and source ports.
+func settingsChanged(cloud string, live, gr *group) bool {
+	return !reflect.DeepEqual(ruleSettings(cloud, live.RulesIn), ruleSettings(cloud, gr.RulesIn)) ||
+		!reflect.DeepEqual(ruleSettings(cloud, live.RulesOut), ruleSettings(cloud, gr.RulesOut))
+}
+
+// ruleSettings maps policy entries to their settings as pushed to cloud.
+func ruleSettings(cloud string, ruleList []rule) map[string]string {
+	settings := map[string]string{}
+
+	for _, r := range ruleList {
+		if cloud == "azure" {
+			ext := r.azure()
+			s := fmt.Sprintf("description=%q name=%s priority=%d destination=%s sourceports=%s",
+				truncateUTF8(r.ruleDescription(), descMaxAzure), ext.Name, ext.Priority,
+				azureSetting(ext.DestinationAddressPrefix, ext.DestinationAddressPrefixes),
+				azureSetting(ext.SourcePortRange, ext.SourcePortRanges))
+			for k := range policyEntries([]rule{r}) {
+				settings[k] = s
+			}
+			continue
+		}
+
+		// aws and openstack store description per block
+		for _, list := range [][]block{r.Blocks, r.BlocksV6} {
+			for _, b := range list {
+				desc := truncateUTF8(b.blockDescription(r), descMaxOpenstack)
+				if cloud == "aws" {
+					desc = truncateUTF8(awsDescriptionClean(b.awsDescription(r)), descMaxAws)
+				}
+				single := r
+				single.Blocks = []block{b}
+				single.BlocksV6 = nil
+				single.Aws = nil
+				single.Openstack = nil
+				for k := range policyEntries([]rule{single}) {
+					settings[k] = fmt.Sprintf("description=%q", desc)
+				}
+			}
+		}
+	}
+
+	return settings
+}
+
+// azureSetting formats azure single or plural field, "*" when both are empty.
+func azureSetting(single string, plural []string) string {
+	if len(plural) > 0 {
+		list := append([]string{}, plural...)
+		sort.Strings(list)
+		return strings.Join(list, ",")
+	}
+	if single == "" {
+		return "*"
+	}
+	return single
+}
+
+// staleGroups finds groups tagged by manifest, within manifest scopes,
+// which are no longer listed in manifest.
+// Numbered parts name-N of a listed group split by push are kept.
+func staleGroups(m *syncManifest) ([]groupRef, error) {
+	listed := map[string]bool{}
+	scopes := map[string]groupRef{}
+	for _, e := range m.Groups {
+		ref := e.ref()
+		listed[ref.cloud+":"+ref.name+"@"+ref.scope] = true
+		scope := groupRef{cloud: ref.cloud, scope: ref.scope, location: ref.location}
+		scopes[ref.cloud+"@"+ref.scope] = scope
+	}
+
+	var keys []string
+	for k := range scopes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var stale []groupRef
+	for _, k := range keys {
+		scope := scopes[k]
+		names, errList := managedGroups(scope, m.Name)
+		if errList != nil {
+			return nil, fmt.Errorf("sync: listing %s groups: %v", k, errList)
+		}
+		for _, name := range names {
+			ref := scope
+			ref.name = name
+			if listed[ref.cloud+":"+ref.name+"@"+ref.scope] {
+				continue
+			}
+			if i := strings.LastIndex(name, "-"); i > 0 && isNumber(name[i+1:]) && listed[ref.cloud+":"+name[:i]+"@"+ref.scope] {
+				continue
+			}
+			stale = append(stale, ref)
+		}
+	}
+
+	return stale, nil
+}
+
+// managedGroups lists names of groups in scope tagged with manifest name.
+func managedGroups(scope groupRef, manifest string) ([]string, error) {
+	scope.setRegion()
+
+	var names []string
+
+	switch scope.cloud {
+	case "aws":
+		svc, errClient := clientAws()
+		if errClient != nil {
+			return nil, errClient
+		}
+		input := ec2.DescribeSecurityGroupsInput{
+			Filters: []ec2.Filter{
+				{Name: aws.String("vpc-id"), Values: []string{scope.scope}},
+				{Name: aws.String("tag:" + tagManifest), Values: []string{manifest}},
+			},
+		}
+		out, errSend := svc.DescribeSecurityGroupsRequest(&input).Send(runCtx)
+		if errSend != nil {
+			return nil, errSend
+		}
+		for _, sg := range out.SecurityGroups {
+			names = append(names, aws.StringValue(sg.GroupName))
+		}
+	case "azure":
+		nsgClient, errClient := clientAzure()
+		if errClient != nil {
+			return nil, errClient
+		}
+		it, errList := nsgClient.ListComplete(runCtx, scope.scope)
+		if errList != nil {
+			return nil, errList
+		}
+		for ; it.NotDone(); it.Next() {
+			nsg := it.Value()
+			if azureTagsPull(nsg.Tags)[tagManifest] == manifest {
+				names = append(names, unptr(nsg.Name))
+			}
+		}
+	case "openstack":
+		client, errClient := clientOpenstack()
+		if errClient != nil {
+			return nil, errClient
+		}
+		allPages, errList := groups.List(client, groups.ListOpts{}).AllPages()
+		if errList != nil {
+			return nil, errList
+		}
+		allGroups, errExtract := groups.ExtractGroups(allPages)
+		if errExtract != nil {
+			return nil, errExtract
+		}
+		for _, sg := range allGroups {
+			if openstackTagsPull(sg.Tags)[tagManifest] == manifest {
+				names = append(names, sg.Name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func isNumber(s string) bool {
+	_, errConv := strconv.Atoi(s)
+	return errConv == nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSyncChanged(t *testing.T) {
+	web := func(edit func(r *rule)) *group {
+		r := rule{
+			Description: "web",
+			Protocol:    "tcp",
+			PortFirst:   443,
+			PortLast:    443,
+			Blocks:      []block{{Address: "10.0.0.0/8"}},
+			Azure:       &ruleAzure{Name: "web", Priority: 100, SourcePortRange: "*", DestinationAddressPrefix: "*"},
+		}
+		if edit != nil {
+			edit(&r)
+		}
+		return &group{RulesIn: []rule{r}}
+	}
+	tagged := func(tags map[string]string) *group {
+		gr := web(nil)
+		gr.Tags = tags
+		return gr
+	}
+	stateless := false
+
+	table := []struct {
+		name  string
+		cloud string
+		live  *group
+		file  *group
+		want  bool
+	}{
+		{"same", "azure", web(nil), web(nil), false},
+		{"azure priority", "azure", web(nil), web(func(r *rule) { r.Azure.Priority = 200 }), true},
+		{"azure name", "azure", web(nil), web(func(r *rule) { r.Azure.Name = "https" }), true},
+		{"azure destination", "azure", web(nil), web(func(r *rule) { r.Azure.DestinationAddressPrefix = "10.1.0.0/16" }), true},
+		{"azure source ports", "azure", web(nil), web(func(r *rule) { r.Azure.SourcePortRanges = []string{"1024-65535"} }), true},
+		{"azure default destination", "azure", web(nil), web(func(r *rule) { r.Azure.DestinationAddressPrefix = "" }), false},
+		{"azure ignored on aws", "aws", web(nil), web(func(r *rule) { r.Azure.Priority = 200 }), false},
+		{"rule description", "aws", web(nil), web(func(r *rule) { r.Description = "https" }), true},
+		{"block description", "openstack", web(nil), web(func(r *rule) { r.Blocks[0].Description = "corp" }), true},
+		{"description moved to block", "aws", web(nil), web(func(r *rule) { r.Description = ""; r.Blocks[0].Description = "web" }), false},
+		{"aws description chars", "aws", web(func(r *rule) { r.Description = "caf_" }), web(func(r *rule) { r.Description = "café" }), false},
+		{"azure description truncated", "azure", web(func(r *rule) { r.Description = strings.Repeat("x", descMaxAzure) }), web(func(r *rule) { r.Description = strings.Repeat("x", 200) }), false},
+		{"aws reserved tags", "aws", tagged(map[string]string{"env": "prod", "aws:cloudformation:stack-name": "s"}), tagged(map[string]string{"env": "prod"}), false},
+		{"azure mapped tag key", "azure", tagged(map[string]string{"a_b": "1"}), tagged(map[string]string{"a/b": "1"}), false},
+		{"openstack shortened tag", "openstack", tagged(pushedTag("openstack", strings.Repeat("k", 80), "v")), tagged(map[string]string{strings.Repeat("k", 80): "v"}), false},
+		{"tag value", "aws", tagged(map[string]string{"env": "dev"}), tagged(map[string]string{"env": "prod"}), true},
+		{"owner", "aws", tagged(map[string]string{tagOwner: "a"}), &group{Owner: "b", RulesIn: web(nil).RulesIn}, true},
+		{"stateless", "openstack", web(nil), &group{Openstack: &groupOpenstack{Stateful: &stateless}, RulesIn: web(nil).RulesIn}, true},
+	}
+
+	for _, data := range table {
+		if data.live.Tags != nil {
+			tags := data.live.Tags
+			data.live.Tags = nil
+			data.live.setTags(tags)
+		}
+		got := metadataChanged(data.cloud, data.live, data.file) || settingsChanged(data.cloud, data.live, data.file)
+		if got != data.want {
+			t.Errorf("%s: changed=%v, want %v", data.name, got, data.want)
+		}
+	}
+}
+
+// pushedTag returns tag as pushed to cloud.
+func pushedTag(cloud, key, value string) map[string]string {
+	gr := group{Tags: map[string]string{key: value}}
+	tags, _ := gr.tagsForCloud(cloud)
+	return tags
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Owner and Ticket are stored as provider tags under these keys.
+const (
+	tagOwner  = "lake-owner"
+	tagTicket = "lake-ticket"
+)
+
+// tagManifest marks groups managed by a sync manifest.
+const tagManifest = "lake-manifest"
+
+type tagLimits struct {
+	maxCount int    // 0 means unlimited
+	maxKey   int    // key length
+	maxValue int    // value length
+	maxTag   int    // whole "key=value" length, for clouds with plain string tags
+	badChars string // replaced by underscore
+}
+
+var tagLimitsTable = map[string]tagLimits{
+	"aws":       {maxCount: 50, maxKey: 128, maxValue: 256},
+	"azure":     {maxCount: 50, maxKey: 512, maxValue: 256, badChars: `<>%&\?/`},
+	"openstack": {maxTag: 60, badChars: ",/"},
+}
+
+// hasTags reports whether group manages provider tags.
+// Groups without tags, owner and ticket leave existing provider tags untouched.
+func (g *group) hasTags() bool {
+	return g.Tags != nil || g.Owner != "" || g.Ticket != ""
+}
+
+// setTags loads provider tags into group.
+func (g *group) setTags(tags map[string]string) {
+	g.Tags = nil
+	for k, v := range tags {
+		switch k {
+		case tagOwner:
+			g.Owner = v
+		case tagTicket:
+			g.Ticket = v
+		default:
+			if g.Tags == nil {
+				g.Tags = map[string]string{}
+			}
+			g.Tags[k] = v
+		}
+	}
+}
+
+// tagsForCloud builds provider tags from group, mapping keys and values
+// to fit cloud limits. Returns warnings for every adjustment.
+func (g *group) tagsForCloud(cloud string) (map[string]string, []string) {
+	limits := tagLimitsTable[cloud]
+
+	var warnings []string
+
+	// owner and ticket come first so they survive count limit
+	var keys []string
+	for k := range g.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	all := map[string]string{}
+	for _, k := range keys {
+		all[k] = g.Tags[k]
+	}
+	if g.Ticket != "" {
+		keys = append([]string{tagTicket}, keys...)
+		all[tagTicket] = g.Ticket
+	}
+	if g.Owner != "" {
+		keys = append([]string{tagOwner}, keys...)
+		all[tagOwner] = g.Owner
+	}
+
+	result := map[string]string{}
+	origin := map[string]string{} // provider key to group key
+
+	for _, k := range keys {
+		v := all[k]
+
+		if cloud == "aws" && strings.HasPrefix(strings.ToLower(k), "aws:") {
+			warnings = append(warnings, fmt.Sprintf("tag key=%s: prefix aws: is reserved, dropping", k))
+			continue
+		}
+
+		if limits.maxCount > 0 && len(result) >= limits.maxCount {
+			warnings = append(warnings, fmt.Sprintf("tag key=%s: %s allows at most %d tags, dropping", k, cloud, limits.maxCount))
+			continue
+		}
+
+		key := replaceChars(k, limits.badChars)
+		value := replaceChars(v, limits.badChars)
+
+		if limits.maxKey > 0 && len(key) > limits.maxKey {
+			key = shortenKey(key, limits.maxKey)
+		}
+		if limits.maxValue > 0 && len(value) > limits.maxValue {
+			value = truncateUTF8(value, limits.maxValue)
+		}
+		if limits.maxTag > 0 {
+			if len(key) > limits.maxTag {
+				key = shortenKey(key, limits.maxTag)
+			}
+			if room := limits.maxTag - len(key) - 1; len(value) > room {
+				if room < 0 {
+					room = 0
+				}
+				value = truncateUTF8(value, room)
+			}
+		}
+
+		if other, found := origin[key]; found {
+			warnings = append(warnings, fmt.Sprintf("tag key=%s mapped to key=%s already used by key=%s for %s, dropping", k, key, other, cloud))
+			continue
+		}
+		origin[key] = k
+
+		if key != k {
+			warnings = append(warnings, fmt.Sprintf("tag key=%s mapped to key=%s for %s", k, key, cloud))
+		}
+		if value != v {
+			warnings = append(warnings, fmt.Sprintf("tag key=%s value adjusted for %s", k, cloud))
+		}
+
+		result[key] = value
+	}
+
+	return result, warnings
+}
+
+func replaceChars(s, chars string) string {
+	if chars == "" {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(chars, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// shortenKey truncates key keeping it unique by a hash suffix.
+func shortenKey(key string, max int) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+	if max <= len(suffix) {
+		return suffix[len(suffix)-max:]
+	}
+	return truncateUTF8(key, max-len(suffix)) + suffix
+}
+
+// openstackTagsPull maps neutron string tags "key=value" to map.
+func openstackTagsPull(tags []string) map[string]string {
+	if len(tags) < 1 {
+		return nil
+	}
+	m := map[string]string{}
+	for _, t := range tags {
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) < 2 {
+			m[kv[0]] = ""
+			continue
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m
+}
+
+// openstackTagsPush maps tags to neutron string tags "key=value".
+func openstackTagsPush(tags map[string]string) []string {
+	list := []string{}
+	for k, v := range tags {
+		if v == "" {
+			list = append(list, k)
+			continue
+		}
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTagsForCloud(t *testing.T) {
+	table := []struct {
+		name     string
+		cloud    string
+		tags     map[string]string
+		want     map[string]string
+		warnings int
+	}{
+		{
+			name:  "collision after char replacement",
+			cloud: "azure",
+			tags:  map[string]string{"a/b": "1", "a_b": "2"},
+			want:  map[string]string{"a_b": "1"},
+			// a/b mapped, a_b dropped
+			warnings: 2,
+		},
+		{
+			name:     "aws reserved prefix",
+			cloud:    "aws",
+			tags:     map[string]string{"aws:cloudformation:stack-name": "s", "env": "prod"},
+			want:     map[string]string{"env": "prod"},
+			warnings: 1,
+		},
+		{
+			name:     "no adjustment",
+			cloud:    "aws",
+			tags:     map[string]string{"a/b": "1", "a_b": "2"},
+			want:     map[string]string{"a/b": "1", "a_b": "2"},
+			warnings: 0,
+		},
+	}
+
+	for _, data := range table {
+		gr := group{Tags: data.tags}
+		got, warnings := gr.tagsForCloud(data.cloud)
+		if len(got) != len(data.want) || len(warnings) != data.warnings {
+			t.Errorf("%s: got %v warnings %v, want %v with %d warning(s)", data.name, got, warnings, data.want, data.warnings)
+			continue
+		}
+		for k, v := range data.want {
+			if got[k] != v {
+				t.Errorf("%s: key=%s: got %q, want %q", data.name, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestTagsForCloudOwnerCollision(t *testing.T) {
+	gr := group{Owner: "team", Tags: map[string]string{"lake-owner": "x"}}
+	got, warnings := gr.tagsForCloud("aws")
+	if got[tagOwner] != "team" || len(got) != 1 || len(warnings) != 1 {
+		t.Errorf("got %v warnings %v", got, warnings)
+	}
+}
+
+func TestTagsForCloudUTF8(t *testing.T) {
+	gr := group{Tags: map[string]string{
+		strings.Repeat("é", 300): strings.Repeat("日", 100),
+	}}
+	for _, cloud := range []string{"aws", "azure", "openstack"} {
+		got, _ := gr.tagsForCloud(cloud)
+		limits := tagLimitsTable[cloud]
+		for k, v := range got {
+			if !utf8.ValidString(k) || !utf8.ValidString(v) {
+				t.Errorf("%s: invalid UTF-8: key=%q value=%q", cloud, k, v)
+			}
+			if limits.maxKey > 0 && len(k) > limits.maxKey || limits.maxValue > 0 && len(v) > limits.maxValue {
+				t.Errorf("%s: key=%d value=%d bytes exceed limits", cloud, len(k), len(v))
+			}
+			if limits.maxTag > 0 && len(k)+1+len(v) > limits.maxTag {
+				t.Errorf("%s: tag=%d bytes exceeds limit", cloud, len(k)+1+len(v))
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// templateDefs holds named address sets and rule snippets shared by groups.
+//
+// Block address "$name" expands into the addresses of set name.
+// Rule with include: name is replaced by the rules of snippet name.
+// Snippets are migrated from apiVersion to current schema like group files.
+type templateDefs struct {
+	APIVersion string `yaml:"apiVersion"`
+	Addresses  map[string][]string
+	Snippets   map[string][]rule
+}
+
+const templateMaxDepth = 10
+
+// expand turns group shorthand (templates, services) into concrete rules.
+func (g *group) expand(baseDir string) error {
+	if errTemplates := g.expandTemplates(baseDir); errTemplates != nil {
+		return errTemplates
+	}
+	return g.expandServices()
+}
+
+// expandTemplates loads definition files listed by group, plus files from env var
+// LAKE_DEFS, then expands address sets and snippets into concrete rules.
+func (g *group) expandTemplates(baseDir string) error {
+	var files []string
+	for _, f := range g.Defs {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(baseDir, f)
+		}
+		files = append(files, f)
+	}
+	if env := os.Getenv("LAKE_DEFS"); env != "" {
+		files = append(files, filepath.SplitList(env)...)
+	}
+
+	if len(files) < 1 && !g.hasTemplates() {
+		return nil
+	}
+
+	defs, errDefs := loadTemplateDefs(files)
+	if errDefs != nil {
+		return errDefs
+	}
+
+	rulesIn, errIn := defs.expandRules(g.RulesIn, 0)
+	if errIn != nil {
+		return fmt.Errorf("RulesIn: %v", errIn)
+	}
+	rulesOut, errOut := defs.expandRules(g.RulesOut, 0)
+	if errOut != nil {
+		return fmt.Errorf("RulesOut: %v", errOut)
+	}
+
+	g.RulesIn = rulesIn
+	g.RulesOut = rulesOut
+	g.Defs = nil
+
+	return nil
+}
+
+// hasTemplates reports whether group references any address set or snippet.
+func (g *group) hasTemplates() bool {
+	for _, list := range [][]rule{g.RulesIn, g.RulesOut} {
+		for _, r := range list {
+			if r.Include != "" {
+				return true
+			}
+			for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+				for _, b := range blocks {
+					if strings.HasPrefix(b.Address, "$") {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func loadTemplateDefs(files []string) (*templateDefs, error) {
+	defs := &templateDefs{
+		Addresses: map[string][]string{},
+		Snippets:  map[string][]rule{},
+	}
+
+	for _, f := range files {
+		slog.Debug("loading template definitions", "file", f)
+
+		buf, errRead := os.ReadFile(f)
+		if errRead != nil {
+			return nil, errRead
+		}
+
+		var d templateDefs
+		if errYaml := yaml.Unmarshal(buf, &d); errYaml != nil {
+			return nil, fmt.Errorf("%s: %v", f, errYaml)
+		}
+
+		for name, addresses := range d.Addresses {
+			if _, found := defs.Addresses[name]; found {
+				return nil, fmt.Errorf("%s: address set redefined: %s", f, name)
+			}
+			defs.Addresses[name] = addresses
+		}
+		for name, snippet := range d.Snippets {
+			if _, found := defs.Snippets[name]; found {
+				return nil, fmt.Errorf("%s: snippet redefined: %s", f, name)
+			}
+			// same schema migration as group files
+			gr := group{APIVersion: d.APIVersion, RulesIn: snippet}
+			if _, errMigrate := gr.migrate(); errMigrate != nil {
+				return nil, fmt.Errorf("%s: snippet %s: %v", f, name, errMigrate)
+			}
+			defs.Snippets[name] = gr.RulesIn
+		}
+	}
+
+	return defs, nil
+}
+
+func (d *templateDefs) expandRules(ruleList []rule, depth int) ([]rule, error) {
+	if depth > templateMaxDepth {
+		return nil, fmt.Errorf("snippets nested too deep (max %d)", templateMaxDepth)
+	}
+
+	var result []rule
+
+	for _, r := range ruleList {
+		if r.Include != "" {
+			snippet, found := d.Snippets[r.Include]
+			if !found {
+				return nil, fmt.Errorf("undefined snippet: %s", r.Include)
+			}
+			expanded, errSnippet := d.expandRules(snippet, depth+1)
+			if errSnippet != nil {
+				return nil, fmt.Errorf("snippet %s: %v", r.Include, errSnippet)
+			}
+			result = append(result, expanded...)
+			continue
+		}
+
+		var v4, v6 []block
+		for _, blocks := range [][]block{r.Blocks, r.BlocksV6} {
+			for _, b := range blocks {
+				expanded, errBlock := d.expandBlock(b, 0)
+				if errBlock != nil {
+					return nil, errBlock
+				}
+				for _, eb := range expanded {
+					if isAddressV6(eb.Address) {
+						v6 = append(v6, eb)
+					} else {
+						v4 = append(v4, eb)
+					}
+				}
+			}
+		}
+		r.Blocks = v4
+		r.BlocksV6 = v6
+
+		result = append(result, r)
+	}
+
+	return result, nil
+}
+
+// expandBlock expands address set reference into blocks.
+// Set entries may reference other sets.
+func (d *templateDefs) expandBlock(b block, depth int) ([]block, error) {
+	if !strings.HasPrefix(b.Address, "$") {
+		return []block{b}, nil
+	}
+	if depth > templateMaxDepth {
+		return nil, fmt.Errorf("address sets nested too deep (max %d)", templateMaxDepth)
+	}
+
+	name := strings.TrimPrefix(b.Address, "$")
+	addresses, found := d.Addresses[name]
+	if !found {
+		return nil, fmt.Errorf("undefined address set: %s", name)
+	}
+
+	var result []block
+	for _, a := range addresses {
+		eb := b
+		eb.Address = a
+		expanded, errExpand := d.expandBlock(eb, depth+1)
+		if errExpand != nil {
+			return nil, fmt.Errorf("address set %s: %v", name, errExpand)
+		}
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
+
+// isAddressV6 reports whether address is IPv6 prefix or address.
+func isAddressV6(address string) bool {
+	n, errNet := blockNet(address)
+	if errNet != nil {
+		return false
+	}
+	_, bits := n.Mask.Size()
+	return bits == 128
+}
+
+func cmdRender(me string, args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+
+	positional, errFlags := parseFlags(fs, args)
+	if errFlags != nil {
+		return errFlags
+	}
+
+	if len(positional) < 1 {
+		return fmt.Errorf("render: missing file")
+	}
+
+	var gr group
+	if errLoad := groupFromFile(me, positional[0], &gr); errLoad != nil {
+		return fmt.Errorf("render: %s: %v", positional[0], errLoad)
+	}
+
+	gr.output()
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSnippetMigration checks that a legacy snippet loads like the same
+// rules given in a legacy group file.
+func TestSnippetMigration(t *testing.T) {
+	legacyRules := `
+- protocol: tcp
+  portfirst: 443
+  portlast: 443
+  azurename: web
+  azurepriority: 100
+  blocks:
+  - address: 10.0.0.0/8
+    awsdescription: corp
+  - address: 172.16.0.0/12
+    azurepush: VirtualNetwork
+    azuresingle: true
+`
+
+	for _, data := range []struct {
+		name       string
+		apiVersion string
+	}{{"v0", ""}, {"v1", "apiVersion: lake/v1\n"}} {
+		dir := t.TempDir()
+
+		defs := data.apiVersion + "snippets:\n  web:" + indent(legacyRules)
+		if errWrite := os.WriteFile(filepath.Join(dir, "defs.yaml"), []byte(defs), 0o644); errWrite != nil {
+			t.Fatal(errWrite)
+		}
+		included := data.apiVersion + "defs: [defs.yaml]\nrulesin:\n- include: web\n"
+		if errWrite := os.WriteFile(filepath.Join(dir, "included.yaml"), []byte(included), 0o644); errWrite != nil {
+			t.Fatal(errWrite)
+		}
+		inline := data.apiVersion + "rulesin:" + legacyRules
+		if errWrite := os.WriteFile(filepath.Join(dir, "inline.yaml"), []byte(inline), 0o644); errWrite != nil {
+			t.Fatal(errWrite)
+		}
+
+		var fromSnippet, fromGroup group
+		if errLoad := groupFromFile("test", filepath.Join(dir, "included.yaml"), &fromSnippet); errLoad != nil {
+			t.Fatalf("%s: %v", data.name, errLoad)
+		}
+		if errLoad := groupFromFile("test", filepath.Join(dir, "inline.yaml"), &fromGroup); errLoad != nil {
+			t.Fatalf("%s: %v", data.name, errLoad)
+		}
+
+		if !reflect.DeepEqual(fromSnippet.RulesIn, fromGroup.RulesIn) {
+			t.Errorf("%s: snippet rules %+v, group rules %+v", data.name, fromSnippet.RulesIn, fromGroup.RulesIn)
+		}
+		r := fromSnippet.RulesIn[0]
+		if r.Azure == nil || r.Azure.Name != "web" || r.Blocks[1].Azure == nil || r.Blocks[1].AzurePush != "" || r.Blocks[1].AzureSingle {
+			t.Errorf("%s: snippet not migrated: %+v", data.name, r)
+		}
+	}
+}
+
+// indent shifts YAML list two levels right, under a map key.
+func indent(s string) string {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		out = append(out, s[i])
+		if s[i] == '\n' && i+1 < len(s) {
+			out = append(out, "  "...)
+		}
+	}
+	return string(out)
+}